@@ -0,0 +1,712 @@
+package emu
+
+
+// The 2A03's audio processing unit: two pulse channels, a triangle, a noise
+// channel and the delta modulation channel, sequenced by the frame counter.
+// It is clocked once per CPU cycle and produces one sample per CPU cycle.
+// All timings are for NTSC consoles
+
+
+// NTSC CPU clock in Hz (21.477272MHz / 12), the rate the APU produces samples at
+const CPU_CLOCK_RATE = 1789773.0
+
+
+var apuLengthTable = [32]uint8{
+	10, 254, 20, 2, 40, 4, 80, 6, 160, 8, 60, 10, 14, 12, 26, 14,
+	12, 16, 24, 18, 48, 20, 96, 22, 192, 24, 72, 26, 16, 28, 32, 30,
+}
+
+var apuDutyTable = [4][8]uint8{
+	{0, 1, 0, 0, 0, 0, 0, 0},  // 12.5%
+	{0, 1, 1, 0, 0, 0, 0, 0},  // 25%
+	{0, 1, 1, 1, 1, 0, 0, 0},  // 50%
+	{1, 0, 0, 1, 1, 1, 1, 1},  // 25% negated
+}
+
+var apuTriangleTable = [32]uint8{
+	15, 14, 13, 12, 11, 10, 9, 8, 7, 6, 5, 4, 3, 2, 1, 0,
+	0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
+}
+
+// in CPU cycles
+var apuNoisePeriods = [16]uint16{
+	4, 8, 16, 32, 64, 96, 128, 160, 202, 254, 380, 508, 762, 1016, 2034, 4068,
+}
+
+// in CPU cycles
+var apuDmcRates = [16]uint16{
+	428, 380, 340, 320, 286, 254, 226, 214, 190, 160, 142, 128, 106, 84, 72, 54,
+}
+
+// Frame counter steps in CPU cycles, the quarter frame clocks envelopes and
+// the triangle's linear counter, the half frame length counters and sweeps
+const (
+	apuFrameStep1 = 7457
+	apuFrameStep2 = 14913
+	apuFrameStep3 = 22371
+	apuFrameStep4 = 29829  // last step of the 4-step sequence
+	apuFrameStep5 = 37281  // last step of the 5-step sequence
+)
+
+// The channels, for ChannelOutput
+const (
+	APU_PULSE1 = iota
+	APU_PULSE2
+	APU_TRIANGLE
+	APU_NOISE
+	APU_DMC
+	APU_CHANNELS
+)
+
+var apuChannelNames = [APU_CHANNELS]string{"pulse1", "pulse2", "triangle", "noise", "dmc"}
+
+// CPU cycles the CPU is held while the DMC fetches a sample byte
+const apuDmcStallCycles = 4
+
+
+// The nonlinear DAC mix, precalculated for every combination of levels
+var apuPulseMix [31]float32
+var apuTndMix [203]float32
+
+func init() {
+	for i := 1; i < len(apuPulseMix); i++ {
+		apuPulseMix[i] = 95.52 / (8128.0 / float32(i) + 100)
+	}
+	for i := 1; i < len(apuTndMix); i++ {
+		apuTndMix[i] = 163.67 / (24329.0 / float32(i) + 100)
+	}
+}
+
+
+type apuEnvelope struct {
+	bStart bool
+	bLoop bool  // also halts the channel's length counter
+	bConstant bool
+	nVolume uint8  // constant volume, or the divider period
+	nDivider uint8
+	nDecay uint8
+}
+
+func (e *apuEnvelope) write(data uint8) {
+	e.bLoop = data & 0x20 != 0
+	e.bConstant = data & 0x10 != 0
+	e.nVolume = data & 0x0F
+}
+
+func (e *apuEnvelope) clock() {
+	if e.bStart {
+		e.bStart = false
+		e.nDecay = 15
+		e.nDivider = e.nVolume
+	} else if e.nDivider == 0 {
+		e.nDivider = e.nVolume
+		if e.nDecay > 0 {
+			e.nDecay--
+		} else if e.bLoop {
+			e.nDecay = 15
+		}
+	} else {
+		e.nDivider--
+	}
+}
+
+func (e *apuEnvelope) output() uint8 {
+	if e.bConstant {
+		return e.nVolume
+	}
+	return e.nDecay
+}
+
+
+type apuPulse struct {
+	bChannel2 bool  // pulse 2's sweep negates with two's complement
+	bEnabled bool
+	envelope apuEnvelope
+	nLength uint8
+
+	nDuty uint8
+	nStep uint8
+	nPeriod uint16
+	nTimer uint16
+
+	bSweepEnabled bool
+	bSweepNegate bool
+	bSweepReload bool
+	nSweepPeriod uint8
+	nSweepShift uint8
+	nSweepDivider uint8
+}
+
+func (p *apuPulse) write(reg uint16, data uint8) {
+	switch reg {
+	case 0:
+		p.nDuty = data >> 6
+		p.envelope.write(data)
+	case 1:
+		p.bSweepEnabled = data & 0x80 != 0
+		p.nSweepPeriod = (data >> 4) & 0x07
+		p.bSweepNegate = data & 0x08 != 0
+		p.nSweepShift = data & 0x07
+		p.bSweepReload = true
+	case 2:
+		p.nPeriod = p.nPeriod & 0x0700 | uint16(data)
+	case 3:
+		p.nPeriod = p.nPeriod & 0x00FF | uint16(data & 0x07) << 8
+		if p.bEnabled {
+			p.nLength = apuLengthTable[data >> 3]
+		}
+		p.nStep = 0
+		p.envelope.bStart = true
+	}
+}
+
+// Clocked every other CPU cycle
+func (p *apuPulse) clockTimer() {
+	if p.nTimer == 0 {
+		p.nTimer = p.nPeriod
+		p.nStep = (p.nStep + 1) & 0x07
+	} else {
+		p.nTimer--
+	}
+}
+
+func (p *apuPulse) sweepTarget() uint16 {
+	change := p.nPeriod >> p.nSweepShift
+	if !p.bSweepNegate {
+		return p.nPeriod + change
+	}
+	if p.bChannel2 {
+		return p.nPeriod - change
+	}
+	return p.nPeriod - change - 1
+}
+
+// The sweep mutes the channel when the target period overflows, even if
+// the sweep is disabled
+func (p *apuPulse) sweepMuting() bool {
+	return p.nPeriod < 8 || (!p.bSweepNegate && p.sweepTarget() > 0x07FF)
+}
+
+func (p *apuPulse) clockSweep() {
+	if p.nSweepDivider == 0 && p.bSweepEnabled && p.nSweepShift > 0 && !p.sweepMuting() {
+		p.nPeriod = p.sweepTarget()
+	}
+	if p.nSweepDivider == 0 || p.bSweepReload {
+		p.nSweepDivider = p.nSweepPeriod
+		p.bSweepReload = false
+	} else {
+		p.nSweepDivider--
+	}
+}
+
+func (p *apuPulse) clockLength() {
+	if !p.envelope.bLoop && p.nLength > 0 {
+		p.nLength--
+	}
+}
+
+func (p *apuPulse) output() uint8 {
+	if p.nLength == 0 || p.sweepMuting() || apuDutyTable[p.nDuty][p.nStep] == 0 {
+		return 0
+	}
+	return p.envelope.output()
+}
+
+
+type apuTriangle struct {
+	bEnabled bool
+	bControl bool  // halts the length counter and keeps reloading the linear counter
+	nLength uint8
+
+	nLinearReload uint8
+	nLinear uint8
+	bLinearReload bool
+
+	nStep uint8
+	nPeriod uint16
+	nTimer uint16
+}
+
+func (t *apuTriangle) write(reg uint16, data uint8) {
+	switch reg {
+	case 0:
+		t.bControl = data & 0x80 != 0
+		t.nLinearReload = data & 0x7F
+	case 2:
+		t.nPeriod = t.nPeriod & 0x0700 | uint16(data)
+	case 3:
+		t.nPeriod = t.nPeriod & 0x00FF | uint16(data & 0x07) << 8
+		if t.bEnabled {
+			t.nLength = apuLengthTable[data >> 3]
+		}
+		t.bLinearReload = true
+	}
+}
+
+// Clocked every CPU cycle. Periods below 2 are ultrasonic and are held
+// instead, which is what most games using them intend
+func (t *apuTriangle) clockTimer() {
+	if t.nTimer == 0 {
+		t.nTimer = t.nPeriod
+		if t.nLength > 0 && t.nLinear > 0 && t.nPeriod >= 2 {
+			t.nStep = (t.nStep + 1) & 0x1F
+		}
+	} else {
+		t.nTimer--
+	}
+}
+
+func (t *apuTriangle) clockLinear() {
+	if t.bLinearReload {
+		t.nLinear = t.nLinearReload
+	} else if t.nLinear > 0 {
+		t.nLinear--
+	}
+	if !t.bControl {
+		t.bLinearReload = false
+	}
+}
+
+func (t *apuTriangle) clockLength() {
+	if !t.bControl && t.nLength > 0 {
+		t.nLength--
+	}
+}
+
+// The triangle keeps outputting its current step when silenced
+func (t *apuTriangle) output() uint8 {
+	return apuTriangleTable[t.nStep]
+}
+
+
+type apuNoise struct {
+	bEnabled bool
+	envelope apuEnvelope
+	nLength uint8
+
+	bShortMode bool  // feedback from bit 6 instead of bit 1
+	nPeriod uint16
+	nTimer uint16
+	nShift uint16
+}
+
+func (n *apuNoise) write(reg uint16, data uint8) {
+	switch reg {
+	case 0:
+		n.envelope.write(data)
+	case 2:
+		n.bShortMode = data & 0x80 != 0
+		n.nPeriod = apuNoisePeriods[data & 0x0F]
+	case 3:
+		if n.bEnabled {
+			n.nLength = apuLengthTable[data >> 3]
+		}
+		n.envelope.bStart = true
+	}
+}
+
+// Clocked every CPU cycle
+func (n *apuNoise) clockTimer() {
+	if n.nTimer > 0 {
+		n.nTimer--
+		return
+	}
+	n.nTimer = n.nPeriod - 1
+
+	tap := uint16(1)
+	if n.bShortMode {
+		tap = 6
+	}
+	feedback := (n.nShift ^ (n.nShift >> tap)) & 0x01
+	n.nShift = n.nShift >> 1 | feedback << 14
+}
+
+func (n *apuNoise) clockLength() {
+	if !n.envelope.bLoop && n.nLength > 0 {
+		n.nLength--
+	}
+}
+
+func (n *apuNoise) output() uint8 {
+	if n.nLength == 0 || n.nShift & 0x01 != 0 {
+		return 0
+	}
+	return n.envelope.output()
+}
+
+
+type apuDmc struct {
+	bIRQEnable bool
+	bIRQ bool
+	bLoop bool
+	nRate uint16
+	nTimer uint16
+
+	nSampleAddress uint16
+	nSampleLength uint16
+	nAddress uint16  // next byte to fetch
+	nBytesRemaining uint16
+
+	nBuffer uint8
+	bBufferFull bool
+
+	nShift uint8
+	nBitsRemaining uint8
+	bSilence bool
+	nLevel uint8  // 7 bit output level
+}
+
+func (d *apuDmc) write(reg uint16, data uint8) {
+	switch reg {
+	case 0:
+		d.bIRQEnable = data & 0x80 != 0
+		d.bLoop = data & 0x40 != 0
+		d.nRate = apuDmcRates[data & 0x0F]
+		if !d.bIRQEnable {
+			d.bIRQ = false
+		}
+	case 1:
+		d.nLevel = data & 0x7F
+	case 2:
+		d.nSampleAddress = 0xC000 | uint16(data) << 6
+	case 3:
+		d.nSampleLength = uint16(data) << 4 | 0x0001
+	}
+}
+
+func (d *apuDmc) restart() {
+	d.nAddress = d.nSampleAddress
+	d.nBytesRemaining = d.nSampleLength
+}
+
+// Clocked every CPU cycle, the output unit plays one bit of the shift
+// register per timer period, moving the level up or down by 2
+func (d *apuDmc) clockTimer() {
+	if d.nTimer > 0 {
+		d.nTimer--
+		return
+	}
+	d.nTimer = d.nRate - 1
+
+	if !d.bSilence {
+		if d.nShift & 0x01 != 0 {
+			if d.nLevel <= 125 {
+				d.nLevel += 2
+			}
+		} else if d.nLevel >= 2 {
+			d.nLevel -= 2
+		}
+	}
+	d.nShift >>= 1
+
+	if d.nBitsRemaining > 0 {
+		d.nBitsRemaining--
+	}
+	if d.nBitsRemaining == 0 {
+		d.nBitsRemaining = 8
+		if d.bBufferFull {
+			d.bSilence = false
+			d.nShift = d.nBuffer
+			d.bBufferFull = false
+		} else {
+			d.bSilence = true
+		}
+	}
+}
+
+// Reports whether the sample buffer needs the next byte
+func (d *apuDmc) needsFetch() bool {
+	return !d.bBufferFull && d.nBytesRemaining > 0
+}
+
+func (d *apuDmc) fill(data uint8) {
+	d.nBuffer = data
+	d.bBufferFull = true
+
+	d.nAddress++
+	if d.nAddress == 0x0000 {
+		d.nAddress = 0x8000
+	}
+	d.nBytesRemaining--
+	if d.nBytesRemaining == 0 {
+		if d.bLoop {
+			d.restart()
+		} else if d.bIRQEnable {
+			d.bIRQ = true
+		}
+	}
+}
+
+
+type APU struct {
+	bus *Bus  // the DMC reads its samples from CPU memory
+	pulse [2]apuPulse
+	triangle apuTriangle
+	noise apuNoise
+	dmc apuDmc
+
+	bFiveStep bool
+	bIRQInhibit bool
+	bFrameIRQ bool
+	nFrameCounter uint32  // CPU cycles into the frame sequence
+	nFrameResetDelay uint8  // cycles until a $4017 write resets the sequence
+	nCycle uint64
+
+	nStallCycles uint8  // CPU cycles still to be held for a DMC fetch
+}
+
+
+func NewAPU() *APU {
+	apu := APU{}
+	apu.pulse[1].bChannel2 = true
+	apu.Reset()
+	return &apu
+}
+
+
+func (apu *APU) ConnectBus(b *Bus) {
+	apu.bus = b
+}
+
+
+func (apu *APU) CpuWrite(addr uint16, data uint8) {
+	switch {
+	case addr >= 0x4000 && addr <= 0x4003:
+		apu.pulse[0].write(addr & 0x03, data)
+	case addr >= 0x4004 && addr <= 0x4007:
+		apu.pulse[1].write(addr & 0x03, data)
+	case addr >= 0x4008 && addr <= 0x400B:
+		apu.triangle.write(addr & 0x03, data)
+	case addr >= 0x400C && addr <= 0x400F:
+		apu.noise.write(addr & 0x03, data)
+	case addr >= 0x4010 && addr <= 0x4013:
+		apu.dmc.write(addr & 0x03, data)
+	case addr == 0x4015:
+		apu.writeStatus(data)
+	case addr == 0x4017:
+		apu.bFiveStep = data & 0x80 != 0
+		apu.bIRQInhibit = data & 0x40 != 0
+		if apu.bIRQInhibit {
+			apu.bFrameIRQ = false
+		}
+		// the sequencer restarts 3 or 4 cycles later depending on alignment
+		apu.nFrameResetDelay = 3 + uint8(apu.nCycle & 0x01)
+	}
+}
+
+
+// $4015 enables the channels, a disabled channel has its length counter
+// (or the DMC's remaining bytes) cleared
+func (apu *APU) writeStatus(data uint8) {
+	apu.pulse[0].bEnabled = data & 0x01 != 0
+	apu.pulse[1].bEnabled = data & 0x02 != 0
+	apu.triangle.bEnabled = data & 0x04 != 0
+	apu.noise.bEnabled = data & 0x08 != 0
+
+	for i := range apu.pulse {
+		if !apu.pulse[i].bEnabled {
+			apu.pulse[i].nLength = 0
+		}
+	}
+	if !apu.triangle.bEnabled {
+		apu.triangle.nLength = 0
+	}
+	if !apu.noise.bEnabled {
+		apu.noise.nLength = 0
+	}
+
+	apu.dmc.bIRQ = false
+	if data & 0x10 == 0 {
+		apu.dmc.nBytesRemaining = 0
+	} else if apu.dmc.nBytesRemaining == 0 {
+		apu.dmc.restart()
+	}
+}
+
+
+// Reads $4015, which also acknowledges the frame IRQ
+func (apu *APU) CpuRead(addr uint16) uint8 {
+	if addr != 0x4015 {
+		return 0x00
+	}
+	data := apu.status()
+	apu.bFrameIRQ = false
+	return data
+}
+
+
+// Length counter, DMC and IRQ flags as seen through $4015
+func (apu *APU) status() uint8 {
+	var data uint8
+	if apu.pulse[0].nLength > 0 {
+		data |= 0x01
+	}
+	if apu.pulse[1].nLength > 0 {
+		data |= 0x02
+	}
+	if apu.triangle.nLength > 0 {
+		data |= 0x04
+	}
+	if apu.noise.nLength > 0 {
+		data |= 0x08
+	}
+	if apu.dmc.nBytesRemaining > 0 {
+		data |= 0x10
+	}
+	if apu.bFrameIRQ {
+		data |= 0x40
+	}
+	if apu.dmc.bIRQ {
+		data |= 0x80
+	}
+	return data
+}
+
+
+// Advances the APU by one CPU cycle
+func (apu *APU) Clock() {
+	apu.clockFrameCounter()
+
+	apu.triangle.clockTimer()
+	apu.noise.clockTimer()
+	apu.dmc.clockTimer()
+	if apu.nCycle & 0x01 == 1 {
+		apu.pulse[0].clockTimer()
+		apu.pulse[1].clockTimer()
+	}
+
+	if apu.dmc.needsFetch() && apu.bus != nil {
+		apu.dmc.fill(apu.bus.CpuRead(apu.dmc.nAddress, true))
+		apu.nStallCycles += apuDmcStallCycles
+	}
+
+	apu.nCycle++
+}
+
+
+func (apu *APU) clockFrameCounter() {
+	if apu.nFrameResetDelay > 0 {
+		apu.nFrameResetDelay--
+		if apu.nFrameResetDelay == 0 {
+			apu.nFrameCounter = 0
+			if apu.bFiveStep {
+				apu.quarterFrame()
+				apu.halfFrame()
+			}
+		}
+	}
+
+	apu.nFrameCounter++
+	switch apu.nFrameCounter {
+	case apuFrameStep1, apuFrameStep3:
+		apu.quarterFrame()
+	case apuFrameStep2:
+		apu.quarterFrame()
+		apu.halfFrame()
+	case apuFrameStep4 - 1:
+		if !apu.bFiveStep {
+			apu.setFrameIRQ()
+		}
+	case apuFrameStep4:
+		if !apu.bFiveStep {
+			apu.quarterFrame()
+			apu.halfFrame()
+			apu.setFrameIRQ()
+		}
+	case apuFrameStep4 + 1:
+		if !apu.bFiveStep {
+			apu.setFrameIRQ()
+			apu.nFrameCounter = 0
+		}
+	case apuFrameStep5:
+		apu.quarterFrame()
+		apu.halfFrame()
+	case apuFrameStep5 + 1:
+		apu.nFrameCounter = 0
+	}
+}
+
+
+func (apu *APU) setFrameIRQ() {
+	if !apu.bIRQInhibit {
+		apu.bFrameIRQ = true
+	}
+}
+
+
+// Envelopes and the triangle's linear counter
+func (apu *APU) quarterFrame() {
+	apu.pulse[0].envelope.clock()
+	apu.pulse[1].envelope.clock()
+	apu.noise.envelope.clock()
+	apu.triangle.clockLinear()
+}
+
+
+// Length counters and sweep units
+func (apu *APU) halfFrame() {
+	apu.pulse[0].clockLength()
+	apu.pulse[1].clockLength()
+	apu.triangle.clockLength()
+	apu.noise.clockLength()
+	apu.pulse[0].clockSweep()
+	apu.pulse[1].clockSweep()
+}
+
+
+// The frame counter and DMC share the CPU IRQ line, makes the APU an IrqSource
+func (apu *APU) IrqPending() bool {
+	return apu.bFrameIRQ || apu.dmc.bIRQ
+}
+
+
+// Reports whether the CPU is held this cycle for a DMC fetch
+func (apu *APU) stall() bool {
+	if apu.nStallCycles == 0 {
+		return false
+	}
+	apu.nStallCycles--
+	return true
+}
+
+
+// Returns the mix of the five channels, from 0 to about 1
+func (apu *APU) Output() float32 {
+	pulse := apu.pulse[0].output() + apu.pulse[1].output()
+	tnd := 3 * uint16(apu.triangle.output()) + 2 * uint16(apu.noise.output()) + uint16(apu.dmc.nLevel)
+	return apuPulseMix[pulse] + apuTndMix[tnd]
+}
+
+
+// Returns a single channel's output as if the others were silent
+func (apu *APU) ChannelOutput(channel int) float32 {
+	switch channel {
+	case APU_PULSE1:
+		return apuPulseMix[apu.pulse[0].output()]
+	case APU_PULSE2:
+		return apuPulseMix[apu.pulse[1].output()]
+	case APU_TRIANGLE:
+		return apuTndMix[3 * uint16(apu.triangle.output())]
+	case APU_NOISE:
+		return apuTndMix[2 * uint16(apu.noise.output())]
+	case APU_DMC:
+		return apuTndMix[apu.dmc.nLevel]
+	}
+	return 0
+}
+
+
+func (apu *APU) Reset() {
+	apu.writeStatus(0x00)
+	apu.dmc.bIRQ = false
+	apu.dmc.nRate = apuDmcRates[0]
+	apu.dmc.nBitsRemaining = 8
+	apu.dmc.bSilence = true
+	apu.noise.nShift = 1
+	apu.noise.nPeriod = apuNoisePeriods[0]
+
+	apu.bFrameIRQ = false
+	apu.nFrameCounter = 0
+	apu.nFrameResetDelay = 0
+	apu.nStallCycles = 0
+}
@@ -0,0 +1,236 @@
+package emu
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+)
+
+// Container formats recognised by their magic bytes
+const (
+	archiveNone = iota
+	archiveZip
+	archiveGzip
+	archiveTar
+)
+
+// enough bytes to see the tar "ustar" signature at offset 257
+const archiveMagicSize = 262
+
+// guards against decompression bombs, no ROM comes close to this
+const maxArchiveMemberSize = 64 << 20
+
+// file extensions treated as ROM images inside archives
+var romExtensions = []string{".nes", ".unf", ".unif", ".fds", ".qd"}
+
+
+var ErrNoRomInArchive = errors.New("archive does not contain a ROM image")
+
+
+// Returned when an archive holds several ROMs and none was chosen
+type ErrAmbiguousArchive struct {
+	Members []string
+}
+
+func (e *ErrAmbiguousArchive) Error() string {
+	return fmt.Sprintf("archive contains %d ROM images, choose one of: %s",
+		len(e.Members), strings.Join(e.Members, ", "))
+}
+
+
+type archiveMember struct {
+	name string
+	data []byte
+}
+
+
+func detectArchive(magic []byte) int {
+	switch {
+	case bytes.HasPrefix(magic, []byte("PK\x03\x04")):
+		return archiveZip
+	case bytes.HasPrefix(magic, []byte{0x1F, 0x8B}):
+		return archiveGzip
+	case len(magic) >= 262 && string(magic[257:262]) == "ustar":
+		return archiveTar
+	}
+	return archiveNone
+}
+
+
+// Unpacks every regular file in an archive, gzip streams holding a tar are
+// treated as a single .tar.gz archive
+func readArchive(data []byte) ([]archiveMember, error) {
+	switch detectArchive(data) {
+	case archiveZip:
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, err
+		}
+
+		var members []archiveMember
+		for _, f := range zr.File {
+			if f.FileInfo().IsDir() {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			content, err := readLimited(rc)
+			rc.Close()
+			if err != nil {
+				return nil, err
+			}
+			members = append(members, archiveMember{f.Name, content})
+		}
+		return members, nil
+
+	case archiveGzip:
+		gr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer gr.Close()
+
+		content, err := readLimited(gr)
+		if err != nil {
+			return nil, err
+		}
+		if detectArchive(content) == archiveTar {
+			return readArchive(content)
+		}
+		return []archiveMember{{gr.Name, content}}, nil
+
+	case archiveTar:
+		tr := tar.NewReader(bytes.NewReader(data))
+
+		var members []archiveMember
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, err
+			}
+			if !hdr.FileInfo().Mode().IsRegular() {
+				continue
+			}
+			content, err := readLimited(tr)
+			if err != nil {
+				return nil, err
+			}
+			members = append(members, archiveMember{hdr.Name, content})
+		}
+		return members, nil
+	}
+
+	return nil, errors.New("unrecognised archive format")
+}
+
+
+func readLimited(r io.Reader) ([]byte, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(r, maxArchiveMemberSize + 1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxArchiveMemberSize {
+		return nil, errors.New("archive member too large")
+	}
+	return data, nil
+}
+
+
+func isRomName(name string) bool {
+	ext := strings.ToLower(path.Ext(name))
+	for _, e := range romExtensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+
+// Filters archive members down to likely ROM images, a lone file with an
+// unknown extension (e.g. a bare gzip stream) is still accepted
+func romMembers(members []archiveMember) []archiveMember {
+	var roms []archiveMember
+	for _, m := range members {
+		if isRomName(m.name) {
+			roms = append(roms, m)
+		}
+	}
+	if len(roms) == 0 && len(members) == 1 {
+		return members
+	}
+	return roms
+}
+
+
+// Lists the ROM images inside a zip, gzip or tar archive
+func ListArchiveRoms(data []byte) ([]string, error) {
+	members, err := readArchive(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, m := range romMembers(members) {
+		names = append(names, m.name)
+	}
+	return names, nil
+}
+
+
+// Loads a ROM from an archive, member names the file to use and may be
+// empty when the archive only holds a single ROM
+func LoadCartridgeArchive(data []byte, member string) (*Cartridge, error) {
+	image, err := romImage(data, member)
+	if err != nil {
+		return nil, err
+	}
+	return loadImage(bytes.NewReader(image))
+}
+
+
+// Returns the raw ROM image held in data, unpacking it first if it is an archive
+func romImage(data []byte, member string) ([]byte, error) {
+	if detectArchive(data) == archiveNone {
+		return data, nil
+	}
+
+	members, err := readArchive(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if member != "" {
+		for _, m := range members {
+			if m.name == member || path.Base(m.name) == member {
+				return m.data, nil
+			}
+		}
+		return nil, fmt.Errorf("archive has no member %q", member)
+	}
+
+	roms := romMembers(members)
+	switch len(roms) {
+	case 0:
+		return nil, ErrNoRomInArchive
+	case 1:
+		return roms[0].data, nil
+	}
+
+	names := make([]string, len(roms))
+	for i, m := range roms {
+		names[i] = m.name
+	}
+	return nil, &ErrAmbiguousArchive{Members: names}
+}
@@ -0,0 +1,24 @@
+package emu
+
+
+// A sound chip on the cartridge, mixed in with the 2A03's own channels.
+// The chips are clocked by their mapper, the mixer only reads them
+type ExpansionAudio interface {
+	// current output, 0 to 1 (or -1 to 1 for chips centred on zero)
+	Output() float32
+	// how loud a full scale Output is relative to the full scale 2A03 mix,
+	// this varies between chips and board revisions so these are averages
+	Level() float32
+	// short name for the chip, used to name its audio stem
+	Name() string
+}
+
+
+// Sums the output of each chip scaled by its level
+func mixExpansionAudio(chips []ExpansionAudio) float32 {
+	out := float32(0)
+	for _, chip := range chips {
+		out += chip.Output() * chip.Level()
+	}
+	return out
+}
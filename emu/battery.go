@@ -0,0 +1,168 @@
+package emu
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+
+// Battery saves live next to the ROM with a .sav extension
+func savePathFor(romPath string) string {
+	return strings.TrimSuffix(romPath, filepath.Ext(romPath)) + ".sav"
+}
+
+
+// Reports whether the cartridge has battery backed PRG-RAM
+func (cart *Cartridge) HasBattery() bool {
+	return cart.info.Battery && len(cart.prgRam) > 0
+}
+
+
+// Reports whether the cartridge has anything to save, battery backed
+// PRG-RAM or a disk system disk
+func (cart *Cartridge) hasSaveData() bool {
+	return cart.HasBattery() || cart.disk != nil
+}
+
+
+func (cart *Cartridge) SavePath() string {
+	return cart.savePath
+}
+
+
+// Returns an *ErrSaveLoad if the save file existed but couldn't be loaded
+// when the ROM was opened, saving is then off until SetSavePath is called
+func (cart *Cartridge) SaveLoadError() error {
+	return cart.saveErr
+}
+
+
+// Changes where battery backed RAM (or a disk system image's writes)
+// is loaded from and flushed to
+func (cart *Cartridge) SetSavePath(path string) {
+	cart.savePath = path
+}
+
+
+// Restores PRG-RAM from the save file, a missing file is not an error.
+// Disk system images get their disk writes back instead
+func (cart *Cartridge) LoadSave() error {
+	if !cart.hasSaveData() || cart.savePath == "" {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(cart.savePath)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if cart.disk != nil {
+		return cart.loadDiskDiff(data)
+	}
+
+	cart.prgRamLock.Lock()
+	copy(cart.prgRam, data)
+	cart.prgRamDirty = false
+	cart.prgRamLock.Unlock()
+	return nil
+}
+
+
+// Writes PRG-RAM to the save file if it has changed since the last flush,
+// or for disk system images the disk writes
+func (cart *Cartridge) FlushSave() error {
+	if !cart.hasSaveData() || cart.savePath == "" {
+		return nil
+	}
+
+	var data []uint8
+	if cart.disk != nil {
+		data = cart.diskDiff()
+		if data == nil {
+			return nil
+		}
+	} else {
+		cart.prgRamLock.Lock()
+		if !cart.prgRamDirty {
+			cart.prgRamLock.Unlock()
+			return nil
+		}
+		data = make([]uint8, len(cart.prgRam))
+		copy(data, cart.prgRam)
+		cart.prgRamDirty = false
+		cart.prgRamLock.Unlock()
+	}
+
+	// write to a temporary file first so a crash can't truncate the save
+	tmpPath := cart.savePath + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0644); err != nil {
+		cart.markSaveDirty()
+		return err
+	}
+	if err := os.Rename(tmpPath, cart.savePath); err != nil {
+		cart.markSaveDirty()
+		return err
+	}
+	return nil
+}
+
+
+func (cart *Cartridge) markSaveDirty() {
+	if cart.disk != nil {
+		cart.disk.diskLock.Lock()
+		cart.disk.bDiskDirty = true
+		cart.disk.diskLock.Unlock()
+		return
+	}
+	cart.prgRamLock.Lock()
+	cart.prgRamDirty = true
+	cart.prgRamLock.Unlock()
+}
+
+
+// Periodically flushes the save file until StopAutoSave is called,
+// errors are passed to onError which may be nil
+func (cart *Cartridge) StartAutoSave(interval time.Duration, onError func(error)) {
+	cart.StopAutoSave()
+	if !cart.hasSaveData() {
+		return
+	}
+
+	stop := make(chan struct{})
+	cart.stopAutoSave = stop
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := cart.FlushSave(); err != nil && onError != nil {
+					onError(err)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+
+func (cart *Cartridge) StopAutoSave() {
+	if cart.stopAutoSave != nil {
+		close(cart.stopAutoSave)
+		cart.stopAutoSave = nil
+	}
+}
+
+
+// Stops auto saving and flushes any outstanding changes, call this on exit
+func (cart *Cartridge) Close() error {
+	cart.StopAutoSave()
+	return cart.FlushSave()
+}
@@ -9,8 +9,9 @@ type Bus struct {
 	cpuRam [0x1FFF + 1]uint8
 	Cpu CPU
 	Ppu PPU
+	Apu APU
 	Controller [2]uint8
-	cart Cartridge
+	cart *Cartridge  // shared with the PPU, so both sides see the same mapper state
 	nSystemClockCounter uint32  // count of how many clock cycles have passed
 	controllerState[2] uint8
 	dmaPage uint8
@@ -18,6 +19,16 @@ type Bus struct {
 	dmaData uint8
 	dmaTransfer bool  // flag indicating if DMA is happening
 	dmaDummy bool
+	irqSources []IrqSource  // everything wired to the CPU IRQ line
+	audioOutput func(sample float32)  // receives one sample per CPU cycle
+	resampler *Resampler  // audio at the host sample rate, nil until a rate is set
+	recorder *audioRecorder  // WAV recording in progress
+}
+
+
+// Anything that can pull the shared CPU IRQ line, e.g. the cartridge or APU
+type IrqSource interface {
+	IrqPending() bool
 }
 
 
@@ -28,6 +39,10 @@ func NewBus() *Bus {
 	bus.Cpu.ConnectBus(&bus)
 	
 	bus.Ppu = *NewPPU()
+
+	bus.Apu = *NewAPU()
+	bus.Apu.ConnectBus(&bus)
+	bus.AddIrqSource(&bus.Apu)
 	
 	bus.nSystemClockCounter = 0
 
@@ -42,6 +57,7 @@ func NewBus() *Bus {
 func (b *Bus) Reset() {
 	b.Ppu.Reset()
 	b.Cpu.Reset()
+	b.Apu.Reset()
 	b.cart.Reset()
 	b.nSystemClockCounter = 0
 	b.dmaPage = 0x00
@@ -57,8 +73,10 @@ func (b *Bus) Clock() {
 
 	// clock CPU 3 times slower then PPU
 	if b.nSystemClockCounter % 3 == 0 {
-		// lock CPU during DMA transfer operation
-		if b.dmaTransfer {
+		// lock CPU while the DMC fetches a sample or during DMA transfer operation
+		if b.Apu.stall() {
+			// the DMC has the bus
+		} else if b.dmaTransfer {
 			if b.dmaDummy {  // wait for correct clock cycle to begin DMA transfer
 				if b.nSystemClockCounter % 2 == 1 {
 					b.dmaDummy = false
@@ -80,6 +98,23 @@ func (b *Bus) Clock() {
 		} else {  // clock CPU if DMA transfer is not taking place
 			b.Cpu.Clock()
 		}
+
+		// the APU and mapper timers keep counting during DMA
+		b.Apu.Clock()
+		b.cart.CpuClock()
+
+		if b.audioOutput != nil || b.resampler != nil || b.recorder != nil {
+			sample := b.AudioSample()
+			if b.audioOutput != nil {
+				b.audioOutput(sample)
+			}
+			if b.resampler != nil {
+				b.resampler.AddSample(sample)
+			}
+			if b.recorder != nil {
+				b.recorder.clock(sample)
+			}
+		}
 	}
 
 	if b.Ppu.Nmi {
@@ -87,13 +122,130 @@ func (b *Bus) Clock() {
 		b.Cpu.NMI()
 	}
 
+	// the IRQ line is level triggered, so keep requesting until every source is acknowledged
+	if b.Cpu.cycles == 0 && b.IrqLine() {
+		b.Cpu.IRQ()
+	}
+
 	b.nSystemClockCounter++
 }
 
 
+// Clocks the bus until the PPU completes a frame
+func (b *Bus) RunFrame() {
+	for {
+		b.Clock()
+		if b.Ppu.FrameComplete {
+			b.Ppu.FrameComplete = false
+			return
+		}
+	}
+}
+
+
 func (b *Bus) InsertCartridge(cartridge *Cartridge) {
-	b.cart = *cartridge
+	if b.cart != nil {
+		b.RemoveIrqSource(b.cart)
+	}
+	b.cart = cartridge
 	b.Ppu.ConnectCartridge(cartridge)
+	b.AddIrqSource(cartridge)
+}
+
+
+// Connects a device to the shared IRQ line
+func (b *Bus) AddIrqSource(src IrqSource) {
+	b.irqSources = append(b.irqSources, src)
+}
+
+
+func (b *Bus) RemoveIrqSource(src IrqSource) {
+	for i, s := range b.irqSources {
+		if s == src {
+			b.irqSources = append(b.irqSources[:i], b.irqSources[i+1:]...)
+			return
+		}
+	}
+}
+
+
+// Returns the state of the IRQ line, asserted while any source has an IRQ pending
+func (b *Bus) IrqLine() bool {
+	for _, src := range b.irqSources {
+		if src.IrqPending() {
+			return true
+		}
+	}
+	return false
+}
+
+
+// Returns the currently inserted cartridge
+func (b *Bus) Cartridge() *Cartridge {
+	return b.cart
+}
+
+
+// Returns the console's current audio output, the APU mixed with any
+// expansion audio on the cartridge
+func (b *Bus) AudioSample() float32 {
+	return b.Apu.Output() + b.cart.AudioSample()
+}
+
+
+// Sets a function to receive the audio output once per CPU cycle
+// (~1.79MHz), nil turns the stream off
+func (b *Bus) SetAudioOutput(output func(sample float32)) {
+	b.audioOutput = output
+}
+
+
+// Starts resampling the audio output to rate Hz (e.g. 44100 or 48000) for
+// ReadSamples, up to half a second is buffered. A rate of 0 turns it off.
+// Set it before the bus starts being clocked
+func (b *Bus) SetSampleRate(rate float64) {
+	if rate <= 0 {
+		b.resampler = nil
+		return
+	}
+	b.resampler = NewResampler(CPU_CLOCK_RATE, rate, int(rate / 2))
+}
+
+
+// Returns the host sample rate, 0 when resampling is off
+func (b *Bus) SampleRate() float64 {
+	if b.resampler == nil {
+		return 0
+	}
+	return b.resampler.SampleRate()
+}
+
+
+// Fills out with mono samples at the host rate, returning how many were
+// available. Safe to call from an audio thread while the bus is clocked
+func (b *Bus) ReadSamples(out []float32) int {
+	if b.resampler == nil {
+		return 0
+	}
+	return b.resampler.ReadSamples(out)
+}
+
+
+// As ReadSamples, but as signed 16 bit PCM
+func (b *Bus) ReadSamplesInt16(out []int16) int {
+	if b.resampler == nil {
+		return 0
+	}
+	return b.resampler.ReadSamplesInt16(out)
+}
+
+
+// Returns how many samples are waiting to be read
+func (b *Bus) SamplesAvailable() int {
+	if b.resampler == nil {
+		return 0
+	}
+	return b.resampler.Available()
 }
 
 
@@ -122,8 +274,12 @@ func (b *Bus) CpuWrite(addr uint16, data uint8) {
 		b.dmaAddr = 0x00
 		b.dmaTransfer = true
 		b.dmaDummy = true
-	} else if addr >= 0x4016 && addr <= 0x4017 {
-		b.controllerState[addr & 0x0001] = b.Controller[addr & 0x0001]
+	} else if (addr >= 0x4000 && addr <= 0x4013) || addr == 0x4015 || addr == 0x4017 {
+		b.Apu.CpuWrite(addr, data)
+	} else if addr == 0x4016 {
+		// the strobe latches both controllers
+		b.controllerState[0] = b.Controller[0]
+		b.controllerState[1] = b.Controller[1]
 	}
 }
 
@@ -138,6 +294,12 @@ func (b *Bus) CpuRead(addr uint16, bReadOnly bool) uint8 {
 		data = b.cpuRam[addr & 0x07FF]
 	} else if addr >= 0x2000 && addr <= 0x3FFF {
 		data = b.Ppu.CpuRead(addr & 0x0007, bReadOnly)
+	} else if addr == 0x4015 {
+		if bReadOnly {
+			data = b.Apu.status()
+		} else {
+			data = b.Apu.CpuRead(addr)
+		}
 	} else if addr >= 0x4016 && addr <= 0x4017 {
 		if (b.controllerState[addr & 0x0001] & 0x80) != 0 {
 		    data = 1
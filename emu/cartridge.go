@@ -1,10 +1,14 @@
 package emu
 
 import (
-	"os"
+	"bufio"
+	"bytes"
 	"encoding/binary"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
+	"sync"
 )
 
 const (
@@ -12,18 +16,38 @@ const (
 	VERTICAL
 	ONESCREEN_LO
 	ONESCREEN_HI
+	HARDWARE  // mirroring is set by the cartridge header
+	FOURSCREEN  // cartridge provides VRAM for all four nametables
 )
 
 type Cartridge struct {
 	prgMemory []uint8  // program memory
 	chrMemory []uint8  // character memory
-	mapperID uint8
-	numPrgBanks uint8  // how many banks of memory for the program
-	numChrBanks uint8  // how many banks of memory for the characters
+	mapperID uint16
+	numPrgBanks uint16  // how many banks of memory for the program
+	numChrBanks uint16  // how many banks of memory for the characters
 	header sHeader  // INES file header
+	info RomInfo  // decoded header
+	dbResult RomDatabaseResult  // ROM database match, if any
 	mapper MapperInterface  // onboard mapper
+	cpuClocked CpuClockedMapper  // optional mapper extensions, nil if not implemented
+	busWatcher PpuBusWatcher
+	irqMapper IrqMapper
+	renderMapper PpuRenderMapper
+	nametableMapper NametableMapper
+	audio []ExpansionAudio
 	imageValid bool
 	mirror int
+
+	vram []uint8  // extra 2K of nametable RAM on four-screen boards
+	disk *Mapper020  // the RAM adapter when this is a disk system image
+
+	prgRam []uint8  // work RAM at $6000-$7FFF, battery backed on some boards
+	prgRamLock sync.Mutex  // guards prgRam against the auto save goroutine
+	prgRamDirty bool  // RAM has changed since it was last saved
+	savePath string  // where battery backed RAM is persisted
+	saveErr error  // why the save file couldn't be loaded, if it couldn't
+	stopAutoSave chan struct{}
 }
 
 
@@ -33,108 +57,356 @@ type sHeader struct {
 	ChrRomChunks uint8  // number of character rom pages
 	Mapper1 uint8
 	Mapper2 uint8
-	PrgRamSize uint8  // rarely used
-	TvSystem1 uint8  // rarely used
-	TvSystem2 uint8  // rarely used
-	Unused [5]byte  // padding
+	PrgRamSize uint8  // NES 2.0: mapper MSB and submapper
+	TvSystem1 uint8  // NES 2.0: PRG/CHR-ROM size MSB
+	TvSystem2 uint8  // NES 2.0: PRG-RAM/NVRAM size
+	Unused [5]byte  // NES 2.0: CHR-RAM size, timing, console type, misc ROMs, expansion device
 }
 
-func NewCartridge(filename string) *Cartridge {
-	cart := Cartridge{}
-	file, err := os.Open(filename)
+// Loads a ROM image from r, zip, gzip and tar archives are unpacked first
+func LoadCartridge(r io.Reader) (*Cartridge, error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(archiveMagicSize)
+	if detectArchive(magic) == archiveNone {
+		return loadImage(br)
+	}
+
+	data, err := ioutil.ReadAll(br)
 	if err != nil {
-		log.Println("Error: could not open ROM file")
-		log.Println(err)
-		return nil
+		return nil, err
+	}
+	return LoadCartridgeArchive(data, "")
+}
+
+
+// Loads an iNES, NES 2.0 or UNIF image from r, picking the format by its magic
+func loadImage(r io.Reader) (*Cartridge, error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(len("\x01*NINTENDO-HVC*"))
+	if string(magic) == unifMagic {
+		return loadUNIF(br)
+	}
+	if isFdsImage(magic) {
+		return nil, ErrFdsBiosRequired  // see LoadFdsCartridge
 	}
-	defer file.Close()
+	return loadINES(br)
+}
+
+
+// Loads an iNES/NES 2.0 image from r
+func loadINES(r io.Reader) (*Cartridge, error) {
+	cart := Cartridge{}
 
 	// Read 16-byte iNES header
-	err = binary.Read(file, binary.LittleEndian, &cart.header)
+	var rawHeader [16]uint8
+	n, err := io.ReadFull(r, rawHeader[:])
 	if err != nil {
-		log.Println("Error: could not read ROM file header")
-		log.Println(err)
-		return nil
+		return nil, readError(err, "header", len(rawHeader), n)
 	}
+	binary.Read(bytes.NewReader(rawHeader[:]), binary.LittleEndian, &cart.header)
 
-	// Seek to byte 16 (past header)
-	_, err = file.Seek(16, 0)
+	if string(cart.header.Name[:]) != "NES\x1A" {
+		return nil, ErrBadMagic
+	}
+
+	cart.info, err = parseRomInfo(cart.header)
 	if err != nil {
-		log.Println("Error: failed to seek past header")
-		log.Println(err)
+		return nil, err
+	}
+	// before allocating, NES 2.0 exponent sizes can be enormous. They needn't
+	// be whole banks either, the ROMs are padded out once they're read
+	banked := cart.info
+	banked.PrgRomSize = wholeBanksSize(cart.info.PrgRomSize, 16384)
+	banked.ChrRomSize = wholeBanksSize(cart.info.ChrRomSize, 8192)
+	if err := checkRomSizes(banked); err != nil {
+		return nil, err
+	}
+
+	var trainer []uint8
+	if cart.info.Trainer {
+		trainer = make([]uint8, 512)
+		n, err = io.ReadFull(r, trainer)
+		if err != nil {
+			return nil, readError(err, "trainer", len(trainer), n)
+		}
+	}
+
+	// Load PRG-ROM
+	cart.prgMemory = make([]uint8, cart.info.PrgRomSize)
+	n, err = io.ReadFull(r, cart.prgMemory)
+	if err != nil {
+		return nil, readError(err, "PRG-ROM", len(cart.prgMemory), n)
+	}
+
+	// Load CHR-ROM
+	var chrRom []uint8
+	if cart.info.ChrRomSize > 0 {
+		chrRom = make([]uint8, cart.info.ChrRomSize)
+		n, err = io.ReadFull(r, chrRom)
+		if err != nil {
+			return nil, readError(err, "CHR-ROM", len(chrRom), n)
+		}
+	}
+
+	cart.prgMemory = padRom(cart.prgMemory, 16384)
+	cart.info.PrgRomSize = uint32(len(cart.prgMemory))
+	chrRom = padRom(chrRom, 8192)
+	cart.info.ChrRomSize = uint32(len(chrRom))
+
+	if err := cart.setup(chrRom, trainer); err != nil {
+		return nil, err
+	}
+	return &cart, nil
+}
+
+
+// Finishes loading once the image has been read, whatever its format:
+// applies any ROM database correction to cart.info, allocates RAM and
+// creates the mapper. chrRom is nil for boards with CHR-RAM
+func (cart *Cartridge) setup(chrRom []uint8, trainer []uint8) error {
+	var err error
+
+	// Correct the header from the ROM database
+	cart.dbResult.Crc32, cart.dbResult.Sha1 = hashRomData(cart.prgMemory, chrRom)
+	if DefaultRomDatabase != nil {
+		if entry, ok := DefaultRomDatabase.Lookup(cart.dbResult.Crc32, cart.dbResult.Sha1); ok {
+			cart.dbResult.Matched = true
+			cart.dbResult.Title = entry.Title
+			cart.dbResult.Overridden = entry.apply(&cart.info)
+		}
+	}
+
+	cart.mapperID = cart.info.Mapper
+	cart.mirror = cart.info.Mirror
+	if cart.info.FourScreen {
+		cart.mirror = FOURSCREEN
+		cart.vram = make([]uint8, 2048)
+	}
+	if err := checkRomSizes(cart.info); err != nil {
+		return err
+	}
+	cart.numPrgBanks = uint16(cart.info.PrgRomSize / 16384)
+	cart.numChrBanks = uint16(cart.info.ChrRomSize / 8192)
+
+	// Use CHR-ROM or allocate CHR-RAM
+	if chrRom != nil {
+		cart.chrMemory = chrRom
+	} else {
+		chrRamSize := cart.info.ChrRamSize + cart.info.ChrNvramSize
+		if chrRamSize < 8192 {
+			chrRamSize = 8192
+		}
+		cart.chrMemory = make([]uint8, chrRamSize)
+	}
+
+	// PRG-RAM, the trainer (if any) gets loaded to $7000
+	cart.prgRam = make([]uint8, cart.info.PrgRamSize + cart.info.PrgNvramSize)
+	if trainer != nil && len(cart.prgRam) >= 0x1200 {
+		copy(cart.prgRam[0x1000:], trainer)
+	}
+
+	cart.mapper, err = newMapper(cart)
+	if err != nil {
+		return err
+	}
+	cart.cpuClocked, _ = cart.mapper.(CpuClockedMapper)
+	cart.busWatcher, _ = cart.mapper.(PpuBusWatcher)
+	cart.irqMapper, _ = cart.mapper.(IrqMapper)
+	cart.renderMapper, _ = cart.mapper.(PpuRenderMapper)
+	cart.nametableMapper, _ = cart.mapper.(NametableMapper)
+	if audioMapper, ok := cart.mapper.(AudioMapper); ok {
+		cart.audio = audioMapper.ExpansionAudio()
+	}
+
+	cart.imageValid = true
+	return nil
+}
+
+
+// Mappers bank PRG-ROM in 16K and CHR-ROM in 8K units, so the sizes have to
+// be whole banks and there has to be some PRG-ROM. Disk system images are
+// the exception, their PRG is the 8K BIOS
+func checkRomSizes(info RomInfo) error {
+	const maxBanks = 0xFFFF
+	if info.Format == FORMAT_FDS {
 		return nil
 	}
+	if info.PrgRomSize == 0 || info.PrgRomSize % 16384 != 0 || info.PrgRomSize / 16384 > maxBanks {
+		return &ErrBadRomSize{Section: "PRG-ROM", Size: info.PrgRomSize}
+	}
+	if info.ChrRomSize % 8192 != 0 || info.ChrRomSize / 8192 > maxBanks {
+		return &ErrBadRomSize{Section: "CHR-ROM", Size: info.ChrRomSize}
+	}
+	return nil
+}
+
+
+// Rounds a ROM size up to a whole number of banks, a size too close to 4G
+// to round is returned as is (checkRomSizes rejects it either way)
+func wholeBanksSize(size uint32, bankSize uint32) uint32 {
+	rounded := (uint64(size) + uint64(bankSize) - 1) / uint64(bankSize) * uint64(bankSize)
+	if rounded > 0xFFFFFFFF {
+		return size
+	}
+	return uint32(rounded)
+}
+
+
+// Loads a ROM image held in memory, e.g. an embedded asset
+func LoadCartridgeBytes(data []byte) (*Cartridge, error) {
+	return LoadCartridge(bytes.NewReader(data))
+}
+
+
+// Optional settings for LoadCartridgeFileWith
+type LoadOptions struct {
+	Member string  // archive member to load, may be empty if the archive holds one ROM
+	Patches []string  // IPS/UPS/BPS patch files, applied in order
+	AutoPatch bool  // without explicit Patches, apply a patch found next to the ROM
+	FdsBios string  // disk system BIOS for .fds/.qd images, defaults to disksys.rom next to the image
+}
+
+
+// Loads a ROM from disk, battery backed RAM is restored from a .sav file next to it
+// and a .bps/.ups/.ips patch with the same name is applied if present
+func LoadCartridgeFile(filename string) (*Cartridge, error) {
+	return LoadCartridgeFileWith(filename, LoadOptions{AutoPatch: true})
+}
+
+
+// Loads a ROM from disk, if the file is an archive holding several ROMs
+// member selects which one to use (see ListArchiveRoms)
+func LoadCartridgeFileMember(filename string, member string) (*Cartridge, error) {
+	return LoadCartridgeFileWith(filename, LoadOptions{Member: member, AutoPatch: true})
+}
+
+
+// Loads a ROM from disk, patches are applied in memory so the file on disk is never modified
+func LoadCartridgeFileWith(filename string, opts LoadOptions) (*Cartridge, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
 
-	// If trainer is present, skip 512 bytes
-	if cart.header.Mapper1&0x04 != 0 {
-		log.Println("Trainer detected, skipping 512 bytes")
-		file.Seek(512, 1)
+	image, err := romImage(data, opts.Member)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
 	}
 
-	// Determine mapper ID
-	cart.mapperID = ((cart.header.Mapper2 >> 4) << 4) | (cart.header.Mapper1 >> 4)
+	patches := opts.Patches
+	if len(patches) == 0 && opts.AutoPatch {
+		if patchPath := findPatchFor(filename); patchPath != "" {
+			patches = []string{patchPath}
+		}
+	}
+	for _, patchPath := range patches {
+		image, err = applyPatchFile(image, patchPath)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	// Determine mirroring mode
-	if cart.header.Mapper1&0x01 != 0 {
-		cart.mirror = VERTICAL
+	var cart *Cartridge
+	if isFdsImage(image) {
+		cart, err = loadFdsFile(filename, image, opts.FdsBios)
 	} else {
-		cart.mirror = HORIZONTAL
+		cart, err = loadImage(bytes.NewReader(image))
 	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+
+	if cart.disk != nil {
+		cart.savePath = fdsDiffPathFor(filename)
+	} else if cart.info.Battery {
+		cart.savePath = savePathFor(filename)
+	}
+	// a bad save shouldn't stop the game from loading, but it also mustn't
+	// be overwritten with blank RAM, so saving stays off until SetSavePath
+	if err := cart.LoadSave(); err != nil {
+		cart.saveErr = &ErrSaveLoad{Path: cart.savePath, Err: err}
+		cart.savePath = ""
+		log.Printf("Warning: %v", cart.saveErr)
+	}
+
+	return cart, nil
+}
+
 
-	// Determine file type
-	nFileType := 1
-	if (cart.header.Mapper2 & 0x0C) == 0x08 {
-		nFileType = 2
+// Loads a ROM held in memory after applying each IPS/UPS/BPS patch in turn
+func LoadCartridgePatched(data []byte, patches ...[]byte) (*Cartridge, error) {
+	image, err := romImage(data, "")
+	if err != nil {
+		return nil, err
 	}
 
-	if nFileType == 1 {
-		// Load PRG-ROM
-		cart.numPrgBanks = cart.header.PrgRomChunks
-		cart.prgMemory = make([]uint8, uint32(cart.numPrgBanks)*16384)
-		_, err = io.ReadFull(file, cart.prgMemory)
+	for _, patch := range patches {
+		image, err = ApplyPatch(image, patch)
 		if err != nil {
-			log.Println("Error: could not fully read PRG-ROM")
-			log.Println(err)
-			return nil
-		}
-
-		// Load CHR-ROM or allocate CHR-RAM
-		cart.numChrBanks = cart.header.ChrRomChunks
-		if cart.numChrBanks == 0 {
-			cart.chrMemory = make([]uint8, 8192)
-		} else {
-			cart.chrMemory = make([]uint8, uint32(cart.numChrBanks)*8192)
-			_, err = io.ReadFull(file, cart.chrMemory)
-			if err != nil {
-				log.Println("Error: could not fully read CHR-ROM")
-				log.Println(err)
-				return nil
-			}
-		}
-	}
-
-	// Mapper setup
-	switch cart.mapperID {
-	case 0:
-		cart.mapper = NewMapper_000(cart.numPrgBanks, cart.numChrBanks)
-	case 2:
-		cart.mapper = NewMapper_002(cart.numPrgBanks, cart.numChrBanks)
-	default:
-		log.Println("Mapper not supported:", cart.mapperID)
+			return nil, err
+		}
+	}
+
+	return loadImage(bytes.NewReader(image))
+}
+
+
+// Loads a ROM from disk, logging any error and returning nil on failure
+func NewCartridge(filename string) *Cartridge {
+	cart, err := LoadCartridgeFile(filename)
+	if err != nil {
+		log.Println("Error: could not load cartridge")
+		log.Println(err)
 		return nil
 	}
+	return cart
+}
+
+
+func newMapper(cart *Cartridge) (MapperInterface, error) {
+	factory := lookupMapper(cart.mapperID, cart.info.SubMapper)
+	if factory == nil {
+		return nil, &ErrUnsupportedMapper{Mapper: cart.mapperID, SubMapper: cart.info.SubMapper}
+	}
 
-	cart.imageValid = true
-	return &cart
+	// factories take bank counts modulo, never hand them an empty ROM
+	if prgBanks, _ := romBanks(cart.info); prgBanks == 0 && cart.info.Format != FORMAT_FDS {
+		return nil, &ErrBadRomSize{Section: "PRG-ROM", Size: cart.info.PrgRomSize}
+	}
+
+	mem := MapperMemory{
+		PrgRom: cart.prgMemory,
+		Chr: cart.chrMemory,
+		ChrRam: cart.info.ChrRomSize == 0,
+		PrgRam: cart.prgRam,
+	}
+	return factory(cart.info, mem)
 }
 
 func (cart *Cartridge) ImageValid() bool {
 	return cart.imageValid
 }
 
+// Returns the information decoded from the ROM header, after any database corrections
+func (cart *Cartridge) Info() RomInfo {
+	return cart.info
+}
+
+// Reports the ROM database match, including the detected title and whether
+// the header was overridden
+func (cart *Cartridge) Database() RomDatabaseResult {
+	return cart.dbResult
+}
+
 func (cart *Cartridge) CpuRead(addr uint16, data *uint8) bool {
 	mappedAddr := uint32(0)
 	if cart.mapper.CpuMapRead(addr, &mappedAddr, data) {
+		if mappedAddr == MAPPER_HANDLED {
+			return true  // mapper has set the data itself
+		}
+		if mappedAddr & MAPPER_PRG_RAM != 0 {
+			return cart.readPrgRam(mappedAddr &^ MAPPER_PRG_RAM, data)
+		}
 		if int(mappedAddr) >= len(cart.prgMemory) {
 			log.Printf("OUT OF BOUNDS READ: mappedAddr=%d, prgMemory size=%d", mappedAddr, len(cart.prgMemory))
 			return false
@@ -142,12 +414,32 @@ func (cart *Cartridge) CpuRead(addr uint16, data *uint8) bool {
 		*data = cart.prgMemory[mappedAddr]
 		return true
 	}
+
+	if addr >= 0x6000 && addr <= 0x7FFF {
+		if cart.mapper.PrgRamMapRead(addr, &mappedAddr) {
+			return cart.readPrgRam(mappedAddr, data)
+		}
+	}
 	return false
 }
 
 func (cart *Cartridge) CpuWrite(addr uint16, data uint8) bool {
 	mappedAddr := uint32(0)
+
+	if addr >= 0x8000 && cart.mapper.BusConflicts() {
+		romData := uint8(0x00)
+		if cart.CpuRead(addr, &romData) {
+			data &= romData
+		}
+	}
+
 	if cart.mapper.CpuMapWrite(addr, &mappedAddr, data) {
+		if mappedAddr == MAPPER_HANDLED {
+			return true  // mapper has stored the data itself
+		}
+		if mappedAddr & MAPPER_PRG_RAM != 0 {
+			return cart.writePrgRam(mappedAddr &^ MAPPER_PRG_RAM, data)
+		}
 		if int(mappedAddr) >= len(cart.prgMemory) {
 			log.Printf("OUT OF BOUNDS WRITE: mappedAddr=%d, prgMemory size=%d", mappedAddr, len(cart.prgMemory))
 			return false
@@ -155,9 +447,37 @@ func (cart *Cartridge) CpuWrite(addr uint16, data uint8) bool {
 		cart.prgMemory[mappedAddr] = data
 		return true
 	}
+
+	if addr >= 0x6000 && addr <= 0x7FFF {
+		if cart.mapper.PrgRamMapWrite(addr, &mappedAddr) {
+			return cart.writePrgRam(mappedAddr, data)
+		}
+	}
 	return false
 }
 
+// PRG-RAM accesses wrap to the RAM actually present, boards without RAM leave the bus open
+func (cart *Cartridge) readPrgRam(offset uint32, data *uint8) bool {
+	if len(cart.prgRam) == 0 {
+		return false
+	}
+	cart.prgRamLock.Lock()
+	*data = cart.prgRam[offset % uint32(len(cart.prgRam))]
+	cart.prgRamLock.Unlock()
+	return true
+}
+
+func (cart *Cartridge) writePrgRam(offset uint32, data uint8) bool {
+	if len(cart.prgRam) == 0 {
+		return false
+	}
+	cart.prgRamLock.Lock()
+	cart.prgRam[offset % uint32(len(cart.prgRam))] = data
+	cart.prgRamDirty = true
+	cart.prgRamLock.Unlock()
+	return true
+}
+
 func (cart *Cartridge) PpuRead(addr uint16, data *uint8) bool {
 	mappedAddr := uint32(0)
 	if cart.mapper.PpuMapRead(addr, &mappedAddr) {
@@ -176,6 +496,101 @@ func (cart *Cartridge) PpuWrite(addr uint16, data uint8) bool {
 	return false
 }
 
+// Offers a PPU read to mappers that take part in rendering, kind is one of the PPU_FETCH constants
+func (cart *Cartridge) PpuFetch(addr uint16, kind int, data *uint8) bool {
+	return cart.renderMapper != nil && cart.renderMapper.PpuFetch(addr, kind, data)
+}
+
+func (cart *Cartridge) PpuStore(addr uint16, data uint8) bool {
+	return cart.renderMapper != nil && cart.renderMapper.PpuStore(addr, data)
+}
+
+// Resolves a $2000-$3EFF address to the 1K of memory behind it, ciram is the
+// console's own 2K of nametable RAM. Returns whether the memory is writable
+func (cart *Cartridge) nametable(addr uint16, ciram *[2][1024]uint8) ([]uint8, bool) {
+	if cart.nametableMapper != nil {
+		if mem, writable := cart.nametableMapper.MapNametable(addr, ciram); mem != nil {
+			return mem, writable
+		}
+	}
+
+	switch cart.Mirror() {
+	case VERTICAL:
+		return ciram[(addr >> 10) & 0x01][:], true
+	case HORIZONTAL:
+		return ciram[(addr >> 11) & 0x01][:], true
+	case ONESCREEN_HI:
+		return ciram[1][:], true
+	case FOURSCREEN:  // CIRAM holds the first two nametables, the cart the other two
+		quadrant := (addr >> 10) & 0x03
+		if quadrant < 2 {
+			return ciram[quadrant][:], true
+		}
+		return cart.vram[(quadrant - 2) * 1024:][:1024], true
+	}
+	return ciram[0][:], true  // ONESCREEN_LO
+}
+
+// Reads a nametable byte for the PPU
+func (cart *Cartridge) NametableRead(addr uint16, ciram *[2][1024]uint8) uint8 {
+	mem, _ := cart.nametable(addr, ciram)
+	return mem[addr & 0x03FF]
+}
+
+// Writes a nametable byte for the PPU, writes to ROM nametables are dropped
+func (cart *Cartridge) NametableWrite(addr uint16, ciram *[2][1024]uint8, data uint8) {
+	if mem, writable := cart.nametable(addr, ciram); writable {
+		mem[addr & 0x03FF] = data
+	}
+}
+
+// Returns the current nametable mirroring mode, mappers can change this at
+// runtime unless the board has four-screen VRAM
+func (cart *Cartridge) Mirror() int {
+	if cart.mirror == FOURSCREEN {
+		return FOURSCREEN
+	}
+	if m := cart.mapper.Mirror(); m != HARDWARE {
+		return m
+	}
+	return cart.mirror
+}
+
+// Clocks mappers with cycle based timers, called once per CPU cycle
+func (cart *Cartridge) CpuClock() {
+	if cart.cpuClocked != nil {
+		cart.cpuClocked.CpuClock()
+	}
+}
+
+// Passes an address the PPU put on its bus to mappers that watch it
+func (cart *Cartridge) PpuBusAddress(addr uint16, ppuClock uint64) {
+	if cart.busWatcher != nil {
+		cart.busWatcher.PpuBusAddress(addr, ppuClock)
+	}
+}
+
+// Reports if the mapper is asserting the IRQ line, makes the cartridge an IrqSource
+func (cart *Cartridge) IrqPending() bool {
+	return cart.irqMapper != nil && cart.irqMapper.IrqPending()
+}
+
+func (cart *Cartridge) IrqAcknowledge() {
+	if cart.irqMapper != nil {
+		cart.irqMapper.IrqAcknowledge()
+	}
+}
+
+// Returns the mixed output of the cartridge's expansion audio, 0 if it has none
+func (cart *Cartridge) AudioSample() float32 {
+	return mixExpansionAudio(cart.audio)
+}
+
+// The cartridge's expansion sound chips, empty if it has none
+func (cart *Cartridge) ExpansionAudio() []ExpansionAudio {
+	return cart.audio
+}
+
 func (cart *Cartridge) Reset() {
 	cart.mapper.Reset()
 }
@@ -0,0 +1,95 @@
+package emu
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+
+// Returned when a ROM doesn't start with the "NES\x1A" or "UNIF" signature
+var ErrBadMagic = errors.New("not an iNES or UNIF file: bad magic number")
+
+
+// Returned when a ROM image ends before a section has been fully read
+type ErrTruncated struct {
+	Section string  // e.g. "header", "PRG-ROM"
+	Want int  // bytes expected
+	Got int  // bytes actually read
+}
+
+func (e *ErrTruncated) Error() string {
+	return fmt.Sprintf("truncated %s: expected %d bytes, got %d", e.Section, e.Want, e.Got)
+}
+
+
+// Reports a failed read of a section, running out of data becomes
+// ErrTruncated and anything else (e.g. a disk error) is passed through
+func readError(err error, section string, want int, got int) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return &ErrTruncated{Section: section, Want: want, Got: got}
+	}
+	return err
+}
+
+
+// A save file (.sav or .fdsdiff) that couldn't be read or applied. The ROM
+// still loads, the error is kept on the cartridge (see SaveLoadError)
+type ErrSaveLoad struct {
+	Path string
+	Err error
+}
+
+func (e *ErrSaveLoad) Error() string {
+	return fmt.Sprintf("could not load save %s: %v", e.Path, e.Err)
+}
+
+func (e *ErrSaveLoad) Unwrap() error {
+	return e.Err
+}
+
+
+// Returned when a ROM's PRG or CHR size isn't something a mapper can bank,
+// e.g. no PRG-ROM at all or a size that isn't a whole number of banks
+type ErrBadRomSize struct {
+	Section string  // "PRG-ROM" or "CHR-ROM"
+	Size uint32  // bytes
+}
+
+func (e *ErrBadRomSize) Error() string {
+	return fmt.Sprintf("bad %s size: %d bytes", e.Section, e.Size)
+}
+
+
+// Returned when a NES 2.0 header gives a ROM size in exponent-multiplier
+// form, 2^Exponent * Multiplier, that doesn't fit in 32 bits
+type ErrRomSizeOverflow struct {
+	Section string  // "PRG-ROM" or "CHR-ROM"
+	Exponent uint8
+	Multiplier uint8
+}
+
+func (e *ErrRomSizeOverflow) Error() string {
+	return fmt.Sprintf("bad header: %s size 2^%d * %d is too large", e.Section, e.Exponent, e.Multiplier)
+}
+
+
+// Returned when no mapper implementation exists for a ROM
+type ErrUnsupportedMapper struct {
+	Mapper uint16
+	SubMapper uint8
+}
+
+func (e *ErrUnsupportedMapper) Error() string {
+	return fmt.Sprintf("unsupported mapper %d (submapper %d)", e.Mapper, e.SubMapper)
+}
+
+
+// Returned when a UNIF image names a board that isn't mapped to a mapper
+type ErrUnsupportedBoard struct {
+	Board string
+}
+
+func (e *ErrUnsupportedBoard) Error() string {
+	return fmt.Sprintf("unsupported UNIF board %q", e.Board)
+}
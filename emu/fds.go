@@ -0,0 +1,340 @@
+package emu
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+
+// Famicom Disk System images come as .fds (65500 byte sides, with an
+// optional 16 byte "FDS\x1A" header) or .qd (65536 byte sides that keep
+// each block's CRC). Both only hold the blocks, so the loader rebuilds what
+// the drive head actually passes over: a lead-in gap, then each block
+// behind a start mark and followed by its CRC and another gap
+const (
+	fdsHeaderSize = 16
+	fdsSideSize = 65500
+	qdSideSize = 65536
+
+	fdsLeadInGap = 28300 / 8  // bytes before the first block
+	fdsBlockGap = 976 / 8  // bytes between blocks
+	fdsRawSideSize = 0x14000  // leaves room after the last block for new files
+)
+
+// Disk image layouts
+const (
+	FDS_IMAGE_FDS = iota
+	FDS_IMAGE_QD
+)
+
+const fdsBiosSize = 8192
+
+
+var ErrFdsBiosRequired = errors.New("FDS images need the disk system BIOS (disksys.rom)")
+var ErrFdsBadBios = errors.New("FDS BIOS must be 8192 bytes")
+var ErrFdsBadImage = errors.New("not a valid FDS disk image")
+
+
+// A loaded disk, sides holds what the drive reads and writes
+type fdsImage struct {
+	format int
+	header []uint8  // fwNES header, nil if the image had none
+	original []uint8  // the image as loaded, disk writes are saved as a diff against it
+	sides [][]uint8
+}
+
+
+// Reports whether data looks like a .fds or .qd disk image
+func isFdsImage(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("FDS\x1A")) || bytes.HasPrefix(data, []byte("\x01*NINTENDO-HVC*"))
+}
+
+
+func parseFdsImage(data []byte) (*fdsImage, error) {
+	img := &fdsImage{original: append([]uint8(nil), data...)}
+
+	body := data
+	if bytes.HasPrefix(data, []byte("FDS\x1A")) {
+		if len(data) < fdsHeaderSize {
+			return nil, &ErrTruncated{Section: "FDS header", Want: fdsHeaderSize, Got: len(data)}
+		}
+		img.header = append([]uint8(nil), data[:fdsHeaderSize]...)
+		body = data[fdsHeaderSize:]
+	}
+
+	// tell the formats apart by side size, if the image is a whole number of
+	// neither (or both) fall back to looking for the disk info block's CRC
+	// that .qd keeps between blocks 1 and 2
+	qd := len(body) % qdSideSize == 0
+	if qd == (len(body) % fdsSideSize == 0) {
+		qd = len(body) > 58 && body[56] != 0x02 && body[58] == 0x02
+	}
+
+	sideSize := fdsSideSize
+	if qd {
+		img.format = FDS_IMAGE_QD
+		sideSize = qdSideSize
+	}
+
+	for offset := 0; offset < len(body); offset += sideSize {
+		end := offset + sideSize
+		if end > len(body) {
+			end = len(body)
+		}
+		blocks := fdsImageBlocks(body[offset:end], img.format == FDS_IMAGE_QD)
+		if len(blocks) == 0 {
+			break
+		}
+		img.sides = append(img.sides, buildRawSide(blocks))
+	}
+
+	if len(img.sides) == 0 {
+		return nil, ErrFdsBadImage
+	}
+	return img, nil
+}
+
+
+// Size of a block from its type byte, file data blocks take their size
+// from the file header block before them
+func fdsBlockSize(code uint8, fileHeader []uint8) int {
+	switch code {
+	case 1:  // disk info
+		return 56
+	case 2:  // file count
+		return 2
+	case 3:  // file header
+		return 16
+	case 4:  // file data
+		if len(fileHeader) == 16 {
+			return 1 + int(binary.LittleEndian.Uint16(fileHeader[13:]))
+		}
+	}
+	return 0
+}
+
+
+// Splits a side from an image file into its blocks
+func fdsImageBlocks(side []uint8, withCrc bool) [][]uint8 {
+	var blocks [][]uint8
+	var fileHeader []uint8
+
+	for p := 0; p < len(side); {
+		size := fdsBlockSize(side[p], fileHeader)
+		if size == 0 || p + size > len(side) {
+			break
+		}
+		block := side[p:p + size]
+		if block[0] == 3 {
+			fileHeader = block
+		}
+		blocks = append(blocks, block)
+
+		p += size
+		if withCrc {
+			p += 2
+		}
+	}
+	return blocks
+}
+
+
+// Lays blocks out as the drive sees them: gap, $80 start mark, block, CRC
+func buildRawSide(blocks [][]uint8) []uint8 {
+	raw := make([]uint8, fdsLeadInGap, fdsRawSideSize)
+	for _, block := range blocks {
+		crc := fdsCrc(block)
+		raw = append(raw, 0x80)
+		raw = append(raw, block...)
+		raw = append(raw, uint8(crc), uint8(crc >> 8))
+		raw = append(raw, make([]uint8, fdsBlockGap)...)
+	}
+	if len(raw) < fdsRawSideSize {
+		raw = raw[:fdsRawSideSize]
+	}
+	return raw
+}
+
+
+// Reads the blocks back out of a side as the drive sees it
+func rawSideBlocks(raw []uint8) [][]uint8 {
+	var blocks [][]uint8
+	var fileHeader []uint8
+
+	p := 0
+	for {
+		for p < len(raw) && raw[p] == 0 {
+			p++
+		}
+		if p + 1 >= len(raw) || raw[p] != 0x80 {
+			break
+		}
+		p++
+
+		size := fdsBlockSize(raw[p], fileHeader)
+		if size == 0 || p + size > len(raw) {
+			break
+		}
+		block := raw[p:p + size]
+		if block[0] == 3 {
+			fileHeader = block
+		}
+		blocks = append(blocks, block)
+		p += size + 2  // skip the CRC
+	}
+	return blocks
+}
+
+
+// CRC-16 over a block, the disk's start mark is folded into the initial value
+func fdsCrc(block []uint8) uint16 {
+	crc := uint16(0x8000)
+	for i := 0; i < len(block) + 2; i++ {
+		var b uint8
+		if i < len(block) {
+			b = block[i]
+		}
+		crc = fdsCrcByte(crc, b)
+	}
+	return crc
+}
+
+
+func fdsCrcByte(crc uint16, b uint8) uint16 {
+	for bit := 0; bit < 8; bit++ {
+		carry := crc & 0x01
+		crc = crc >> 1 | uint16(b >> bit & 0x01) << 15
+		if carry != 0 {
+			crc ^= 0x8408
+		}
+	}
+	return crc
+}
+
+
+// Rebuilds an image file in the original layout from the drive's sides.
+// A side holding more than fits in the image is cut short
+func (img *fdsImage) encode(sides [][]uint8) []uint8 {
+	sideSize := fdsSideSize
+	if img.format == FDS_IMAGE_QD {
+		sideSize = qdSideSize
+	}
+
+	out := append([]uint8(nil), img.header...)
+	for _, raw := range sides {
+		side := make([]uint8, 0, sideSize)
+		for _, block := range rawSideBlocks(raw) {
+			side = append(side, block...)
+			if img.format == FDS_IMAGE_QD {
+				crc := fdsCrc(block)
+				side = append(side, uint8(crc), uint8(crc >> 8))
+			}
+		}
+		if len(side) > sideSize {
+			side = side[:sideSize]
+		}
+		out = append(out, side...)
+		out = append(out, make([]uint8, sideSize - len(side))...)
+	}
+
+	// keep anything trailing the sides in the original, e.g. padding
+	if len(out) < len(img.original) {
+		out = append(out, img.original[len(out):]...)
+	}
+	return out[:len(img.original)]
+}
+
+
+// Disk writes are kept next to the image in a .fdsdiff file, an IPS patch
+// against the original image which itself is never modified
+func fdsDiffPathFor(imagePath string) string {
+	return strings.TrimSuffix(imagePath, filepath.Ext(imagePath)) + ".fdsdiff"
+}
+
+
+// Builds a disk system cartridge from the BIOS and a .fds/.qd disk image,
+// side 0 is inserted to start with
+func LoadFdsCartridge(bios []byte, image []byte) (*Cartridge, error) {
+	if bios == nil {
+		return nil, ErrFdsBiosRequired
+	}
+	if len(bios) != fdsBiosSize {
+		return nil, ErrFdsBadBios
+	}
+
+	img, err := parseFdsImage(image)
+	if err != nil {
+		return nil, err
+	}
+
+	cart := Cartridge{}
+	cart.prgMemory = append([]uint8(nil), bios...)
+	cart.info = RomInfo{
+		Format: FORMAT_FDS,
+		Mapper: 20,
+		PrgRomSize: fdsBiosSize,
+		PrgRamSize: 32768,
+		ChrRamSize: 8192,
+		Mirror: HORIZONTAL,
+	}
+
+	if err := cart.setup(nil, nil); err != nil {
+		return nil, err
+	}
+	disk, ok := cart.mapper.(*Mapper020)
+	if !ok {
+		return nil, &ErrUnsupportedMapper{Mapper: 20}
+	}
+	disk.insertImage(img)
+	cart.disk = disk
+	return &cart, nil
+}
+
+
+// Loads a disk image from disk, the BIOS comes from biosPath or failing
+// that disksys.rom in the image's directory
+func loadFdsFile(imagePath string, image []byte, biosPath string) (*Cartridge, error) {
+	if biosPath == "" {
+		biosPath = filepath.Join(filepath.Dir(imagePath), "disksys.rom")
+	}
+	bios, err := ioutil.ReadFile(biosPath)
+	if os.IsNotExist(err) {
+		return nil, ErrFdsBiosRequired
+	} else if err != nil {
+		return nil, err
+	}
+	return LoadFdsCartridge(bios, image)
+}
+
+
+// The disk system RAM adapter, for switching disk sides. Returns nil for
+// anything but a disk system image
+func (cart *Cartridge) DiskSystem() *Mapper020 {
+	return cart.disk
+}
+
+
+// Applies the saved disk writes to the inserted image
+func (cart *Cartridge) loadDiskDiff(diff []byte) error {
+	image, err := ApplyPatch(cart.disk.image.original, diff)
+	if err != nil {
+		return err
+	}
+	return cart.disk.restoreImage(image)
+}
+
+
+// The disk writes as an IPS patch against the original image, nil if
+// nothing has been written since the last call
+func (cart *Cartridge) diskDiff() []byte {
+	image, dirty := cart.disk.diskImage(true)
+	if !dirty {
+		return nil
+	}
+	return createIPS(cart.disk.image.original, image)
+}
@@ -0,0 +1,265 @@
+package emu
+
+
+// Famicom Disk System sound: a single channel playing a 64 step, 6 bit
+// wavetable, with a volume envelope and a frequency modulator that has its
+// own envelope and a 64 step table of pitch offsets
+type FdsAudio struct {
+	wave [64]uint8
+	bWaveWrite bool  // $4089 bit 7, wave RAM is writable and the output held
+	nMasterVolume uint8
+
+	nFrequency uint16
+	bWaveHalt bool
+	bEnvelopeHalt bool
+	nWaveAccumulator uint32
+	nWavePosition uint8
+	nOutputGain uint8  // volume gain, latched at the start of each wave cycle
+
+	volume fdsEnvelope
+	modEnvelope fdsEnvelope
+	nMasterEnvelopeSpeed uint8
+
+	modTable [64]uint8
+	nModPosition uint8
+	nModFrequency uint16
+	bModHalt bool
+	nModAccumulator uint32
+	nModCounter int  // 7 bit signed
+}
+
+type fdsEnvelope struct {
+	nSpeed uint8
+	nGain uint8
+	bIncrease bool
+	bDisabled bool  // gain is set directly by the register
+	nTimer uint32
+}
+
+
+// Modulator steps for each 3 bit table entry, 4 resets the counter
+var fdsModSteps = [8]int{0, 1, 2, 4, 0, -4, -2, -1}
+
+// $4089 master volume: 2/2, 2/3, 2/4 or 2/5
+var fdsMasterVolumes = [4]float32{1, 2.0 / 3, 2.0 / 4, 2.0 / 5}
+
+
+func NewFdsAudio() *FdsAudio {
+	chip := FdsAudio{}
+	chip.Reset()
+	return &chip
+}
+
+
+func (e *fdsEnvelope) write(data uint8, masterSpeed uint8) {
+	e.nSpeed = data & 0x3F
+	e.bIncrease = data & 0x40 != 0
+	e.bDisabled = data & 0x80 != 0
+	if e.bDisabled {
+		e.nGain = e.nSpeed
+	}
+	e.reload(masterSpeed)
+}
+
+
+func (e *fdsEnvelope) reload(masterSpeed uint8) {
+	e.nTimer = 8 * (uint32(e.nSpeed) + 1) * uint32(masterSpeed)
+}
+
+
+func (e *fdsEnvelope) clock(masterSpeed uint8) {
+	if e.bDisabled || masterSpeed == 0 {
+		return
+	}
+	if e.nTimer > 0 {
+		e.nTimer--
+		return
+	}
+	e.reload(masterSpeed)
+	if e.bIncrease && e.nGain < 32 {
+		e.nGain++
+	} else if !e.bIncrease && e.nGain > 0 {
+		e.nGain--
+	}
+}
+
+
+// Reads $4040-$409F, returns false for write only registers
+func (f *FdsAudio) Read(addr uint16, data *uint8) bool {
+	switch {
+	case addr >= 0x4040 && addr <= 0x407F:
+		*data = f.wave[addr & 0x3F] | 0x40
+	case addr == 0x4090:
+		*data = f.volume.nGain | 0x40
+	case addr == 0x4092:
+		*data = f.modEnvelope.nGain | 0x40
+	default:
+		return false
+	}
+	return true
+}
+
+
+// Writes $4040-$408A
+func (f *FdsAudio) Write(addr uint16, data uint8) {
+	switch {
+	case addr >= 0x4040 && addr <= 0x407F:
+		if f.bWaveWrite {
+			f.wave[addr & 0x3F] = data & 0x3F
+		}
+	case addr == 0x4080:
+		f.volume.write(data, f.nMasterEnvelopeSpeed)
+	case addr == 0x4082:
+		f.nFrequency = f.nFrequency & 0x0F00 | uint16(data)
+	case addr == 0x4083:
+		f.nFrequency = f.nFrequency & 0x00FF | uint16(data & 0x0F) << 8
+		f.bWaveHalt = data & 0x80 != 0
+		f.bEnvelopeHalt = data & 0x40 != 0
+		if f.bWaveHalt {
+			f.nWaveAccumulator = 0
+			f.nWavePosition = 0
+		}
+		if f.bEnvelopeHalt {
+			f.volume.reload(f.nMasterEnvelopeSpeed)
+			f.modEnvelope.reload(f.nMasterEnvelopeSpeed)
+		}
+	case addr == 0x4084:
+		f.modEnvelope.write(data, f.nMasterEnvelopeSpeed)
+	case addr == 0x4085:
+		f.nModCounter = int(int8(data << 1)) >> 1
+	case addr == 0x4086:
+		f.nModFrequency = f.nModFrequency & 0x0F00 | uint16(data)
+	case addr == 0x4087:
+		f.nModFrequency = f.nModFrequency & 0x00FF | uint16(data & 0x0F) << 8
+		f.bModHalt = data & 0x80 != 0
+		if f.bModHalt {
+			f.nModAccumulator = 0
+		}
+	case addr == 0x4088:
+		// the table can only be written while the modulator is halted,
+		// each write fills two entries
+		if f.bModHalt {
+			f.modTable[f.nModPosition] = data & 0x07
+			f.modTable[(f.nModPosition + 1) & 0x3F] = data & 0x07
+			f.nModPosition = (f.nModPosition + 2) & 0x3F
+		}
+	case addr == 0x4089:
+		f.bWaveWrite = data & 0x80 != 0
+		f.nMasterVolume = data & 0x03
+	case addr == 0x408A:
+		f.nMasterEnvelopeSpeed = data
+	}
+}
+
+
+// Advances the chip by one CPU cycle
+func (f *FdsAudio) Clock() {
+	if !f.bWaveHalt && !f.bEnvelopeHalt {
+		f.volume.clock(f.nMasterEnvelopeSpeed)
+		f.modEnvelope.clock(f.nMasterEnvelopeSpeed)
+	}
+
+	if !f.bModHalt && f.nModFrequency > 0 {
+		f.nModAccumulator += uint32(f.nModFrequency)
+		if f.nModAccumulator >= 0x10000 {
+			f.nModAccumulator -= 0x10000
+			f.stepModulator()
+		}
+	}
+
+	if f.bWaveHalt || f.bWaveWrite {
+		return
+	}
+
+	pitch := f.modulatedPitch()
+	if pitch <= 0 {
+		return
+	}
+	f.nWaveAccumulator += uint32(pitch)
+	for f.nWaveAccumulator >= 0x10000 {
+		f.nWaveAccumulator -= 0x10000
+		f.nWavePosition = (f.nWavePosition + 1) & 0x3F
+		if f.nWavePosition == 0 {
+			f.nOutputGain = f.volume.nGain
+		}
+	}
+}
+
+
+func (f *FdsAudio) stepModulator() {
+	step := f.modTable[f.nModPosition]
+	if step == 4 {
+		f.nModCounter = 0
+	} else {
+		f.nModCounter += fdsModSteps[step]
+		if f.nModCounter >= 64 {
+			f.nModCounter -= 128
+		} else if f.nModCounter < -64 {
+			f.nModCounter += 128
+		}
+	}
+	f.nModPosition = (f.nModPosition + 1) & 0x3F
+}
+
+
+// The wave frequency after modulation, using the hardware's rounding
+func (f *FdsAudio) modulatedPitch() int {
+	pitch := int(f.nFrequency)
+	if f.bModHalt {
+		return pitch
+	}
+
+	temp := f.nModCounter * int(f.modEnvelope.nGain)
+	remainder := temp & 0x0F
+	temp >>= 4
+	if remainder > 0 && temp & 0x80 == 0 {
+		if f.nModCounter < 0 {
+			temp -= 1
+		} else {
+			temp += 2
+		}
+	}
+	if temp >= 192 {
+		temp -= 256
+	} else if temp < -64 {
+		temp += 256
+	}
+
+	temp = pitch * temp
+	remainder = temp & 0x3F
+	temp >>= 6
+	if remainder >= 32 {
+		temp++
+	}
+	return pitch + temp
+}
+
+
+// Returns the channel output, from 0 to 1
+func (f *FdsAudio) Output() float32 {
+	gain := f.nOutputGain
+	if gain > 32 {
+		gain = 32
+	}
+	sample := float32(f.wave[f.nWavePosition]) * float32(gain) / (63 * 32)
+	return sample * fdsMasterVolumes[f.nMasterVolume]
+}
+
+
+// At full volume the FDS channel is over twice as loud as a 2A03 pulse
+func (f *FdsAudio) Level() float32 {
+	return 0.35
+}
+
+
+func (f *FdsAudio) Name() string {
+	return "fds"
+}
+
+
+func (f *FdsAudio) Reset() {
+	*f = FdsAudio{}
+	f.bWaveHalt = true
+	f.bModHalt = true
+	f.nMasterEnvelopeSpeed = 0xE8
+}
@@ -1,16 +1,214 @@
 package emu
 
+import (
+	"sort"
+	"sync"
+)
+
 
 type MapperInterface interface {
 	CpuMapRead(addr uint16, mapped_addr *uint32, data *uint8) bool 
 	CpuMapWrite(addr uint16, mapped_addr *uint32, data uint8) bool 
 	PpuMapRead(addr uint16, mapped_addr *uint32) bool 
 	PpuMapWrite(addr uint16, mapped_addr *uint32) bool
+	Mirror() int
+	BusConflicts() bool
+	PrgRamMapRead(addr uint16, mapped_addr *uint32) bool
+	PrgRamMapWrite(addr uint16, mapped_addr *uint32) bool
 	Reset()
 }
 
 
+// Optional interfaces a mapper can implement on top of MapperInterface,
+// the cartridge checks for them once when the mapper is created
+
+// Mappers with cycle based timers (VRC IRQs, FME-7, FDS) get clocked
+// once per CPU cycle
+type CpuClockedMapper interface {
+	CpuClock()
+}
+
+// Called with every address the PPU places on its bus while fetching,
+// used by mappers that count scanlines from PPU A12 or latch on tile fetches
+type PpuBusWatcher interface {
+	PpuBusAddress(addr uint16, ppuClock uint64)
+}
+
+// What a PPU read is for, passed to PpuRenderMapper
+const (
+	PPU_FETCH_CPU = iota  // $2007 access, or a read while rendering is disabled
+	PPU_FETCH_NAMETABLE
+	PPU_FETCH_ATTRIBUTE
+	PPU_FETCH_BACKGROUND  // background pattern
+	PPU_FETCH_SPRITE  // sprite pattern
+)
+
+// Mappers that take part in rendering (e.g. MMC5 split screen and extended
+// attributes). PpuFetch can supply the byte for any $0000-$3EFF read and
+// PpuStore can take any write, returning false leaves the access to the
+// cartridge and PPU memory as normal
+type PpuRenderMapper interface {
+	PpuFetch(addr uint16, kind int, data *uint8) bool
+	PpuStore(addr uint16, data uint8) bool
+}
+
+// Mappers that decide where each nametable quadrant comes from instead of
+// using one of the fixed mirroring modes. MapNametable returns the 1K of
+// memory backing addr, which may be a CIRAM page, cartridge RAM or CHR-ROM,
+// and whether it can be written. A nil slice falls back to the mirroring mode
+type NametableMapper interface {
+	MapNametable(addr uint16, ciram *[2][1024]uint8) ([]uint8, bool)
+}
+
+// Mappers with expansion sound chips, clocked through CpuClock.
+// The same chips must be returned for the life of the mapper
+type AudioMapper interface {
+	ExpansionAudio() []ExpansionAudio
+}
+
+// Mappers that drive the cartridge IRQ line, IrqPending stays true until the
+// game acknowledges the interrupt through the mapper registers or
+// IrqAcknowledge is called
+type IrqMapper interface {
+	IrqPending() bool
+	IrqAcknowledge()
+}
+
+
+// returned as the mapped address when the mapper has handled the data itself
+// (e.g. onboard RAM) and the cartridge should not touch its own memory
+const MAPPER_HANDLED = 0xFFFFFFFF
+
+// set in a mapped CPU address to point it at PRG-RAM instead of PRG-ROM,
+// for boards that can bank RAM into the $8000-$FFFF range
+const MAPPER_PRG_RAM = 0x80000000
+
+
 type Mapper struct {
-	numPrgBanks uint8
-	numChrBanks uint8
+	numPrgBanks uint16
+	numChrBanks uint16
+}
+
+
+// Creates the base for a mapper, sized from the ROM info. Mappers defined
+// outside this package embed the result to pick up the default methods
+func NewMapperBase(info RomInfo) Mapper {
+	prgBanks, chrBanks := romBanks(info)
+	return Mapper{numPrgBanks: prgBanks, numChrBanks: chrBanks}
+}
+
+
+// Number of 16K PRG-ROM banks
+func (mapper *Mapper) PrgBanks() uint16 {
+	return mapper.numPrgBanks
+}
+
+
+// Number of 8K CHR-ROM banks, 0 when the board uses CHR-RAM
+func (mapper *Mapper) ChrBanks() uint16 {
+	return mapper.numChrBanks
+}
+
+
+// Converts ROM sizes into the 16K PRG and 8K CHR bank counts mappers work in
+func romBanks(info RomInfo) (uint16, uint16) {
+	return uint16(info.PrgRomSize / 16384), uint16(info.ChrRomSize / 8192)
+}
+
+
+// Mirroring is fixed by the cartridge hardware unless a mapper overrides this
+func (mapper *Mapper) Mirror() int {
+	return HARDWARE
+}
+
+
+// Discrete logic boards that don't disable ROM output during register writes
+// have bus conflicts, the written value gets ANDed with the ROM byte
+func (mapper *Mapper) BusConflicts() bool {
+	return false
+}
+
+
+// Maps a $6000-$7FFF access into the cartridge PRG-RAM, by default RAM is
+// always enabled and a single 8K bank is mirrored across its size
+func (mapper *Mapper) PrgRamMapRead(addr uint16, mapped_addr *uint32) bool {
+	*mapped_addr = uint32(addr & 0x1FFF)
+	return true
+}
+
+
+func (mapper *Mapper) PrgRamMapWrite(addr uint16, mapped_addr *uint32) bool {
+	*mapped_addr = uint32(addr & 0x1FFF)
+	return true
+}
+
+
+// Cartridge memory handed to a mapper factory, mappers that need direct
+// access (e.g. for onboard RAM tricks) may keep these slices
+type MapperMemory struct {
+	PrgRom []uint8
+	Chr []uint8  // CHR-ROM, or CHR-RAM when ChrRam is set
+	ChrRam bool
+	PrgRam []uint8  // PRG-RAM and battery backed RAM, may be empty
+}
+
+
+// Builds a mapper for a cartridge
+type MapperFactory func(info RomInfo, mem MapperMemory) (MapperInterface, error)
+
+
+// Registers a factory for every submapper of a mapper number that doesn't
+// have a more specific registration
+const ANY_SUBMAPPER = -1
+
+
+type MapperRegistration struct {
+	Mapper uint16
+	SubMapper int  // ANY_SUBMAPPER or a NES 2.0 submapper
+}
+
+
+var mapperRegistry = struct {
+	sync.RWMutex
+	factories map[MapperRegistration]MapperFactory
+}{factories: make(map[MapperRegistration]MapperFactory)}
+
+
+// Makes a mapper available to the cartridge loader, registering the same
+// mapper and submapper again replaces the earlier factory
+func RegisterMapper(id uint16, submapper int, factory MapperFactory) {
+	mapperRegistry.Lock()
+	defer mapperRegistry.Unlock()
+	mapperRegistry.factories[MapperRegistration{id, submapper}] = factory
+}
+
+
+// Lists the registered mappers, sorted by mapper then submapper
+func RegisteredMappers() []MapperRegistration {
+	mapperRegistry.RLock()
+	defer mapperRegistry.RUnlock()
+
+	list := make([]MapperRegistration, 0, len(mapperRegistry.factories))
+	for reg := range mapperRegistry.factories {
+		list = append(list, reg)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Mapper != list[j].Mapper {
+			return list[i].Mapper < list[j].Mapper
+		}
+		return list[i].SubMapper < list[j].SubMapper
+	})
+	return list
+}
+
+
+// Finds the factory for a mapper, preferring an exact submapper match
+func lookupMapper(id uint16, submapper uint8) MapperFactory {
+	mapperRegistry.RLock()
+	defer mapperRegistry.RUnlock()
+
+	if factory, ok := mapperRegistry.factories[MapperRegistration{id, int(submapper)}]; ok {
+		return factory
+	}
+	return mapperRegistry.factories[MapperRegistration{id, ANY_SUBMAPPER}]
 }
@@ -1,11 +1,18 @@
 package emu
 
 
+func init() {
+	RegisterMapper(0, ANY_SUBMAPPER, func(info RomInfo, mem MapperMemory) (MapperInterface, error) {
+		return NewMapper_000(romBanks(info)), nil
+	})
+}
+
+
 type Mapper000 struct {
 	Mapper
 }
 
-func NewMapper_000(prgBanks uint8, chrBanks uint8) *Mapper000 {
+func NewMapper_000(prgBanks uint16, chrBanks uint16) *Mapper000 {
 	mapper := Mapper000{}
 	mapper.numPrgBanks = prgBanks
 	mapper.numChrBanks = chrBanks
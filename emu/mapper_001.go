@@ -0,0 +1,216 @@
+package emu
+
+
+func init() {
+	RegisterMapper(1, ANY_SUBMAPPER, func(info RomInfo, mem MapperMemory) (MapperInterface, error) {
+		return NewMapper_001(romBanks(info)), nil
+	})
+}
+
+
+// MMC1 (SxROM boards)
+type Mapper001 struct {
+	Mapper
+	nLoadRegister uint8  // serial shift register
+	nLoadRegisterCount uint8  // number of bits shifted in so far
+	nControlRegister uint8  // mirroring, PRG and CHR bank modes
+	nCHRBankSelect0 uint8
+	nCHRBankSelect1 uint8
+	nPRGBankSelect uint8
+	nWriteCooldown uint8  // CPU cycles until the serial port accepts another write
+}
+
+func NewMapper_001(prgBanks uint16, chrBanks uint16) *Mapper001 {
+	mapper := Mapper001{}
+	mapper.numPrgBanks = prgBanks
+	mapper.numChrBanks = chrBanks
+
+	return &mapper
+}
+
+
+// SUROM/SXROM boards with 512K of PRG use bit 4 of the CHR bank register
+// to select which 256K half of PRG-ROM is visible
+func (m *Mapper001) prgOuterBank() uint32 {
+	if m.numPrgBanks > 16 {
+		return uint32(m.nCHRBankSelect0 & 0x10)
+	}
+	return 0
+}
+
+
+// Returns the number of 16K banks in the currently selected 256K PRG window
+func (m *Mapper001) prgBankCount() uint32 {
+	if m.numPrgBanks > 16 {
+		return 16
+	}
+	return uint32(m.numPrgBanks)
+}
+
+
+func (m *Mapper001) prgRamEnabled() bool {
+	return m.nPRGBankSelect & 0x10 == 0
+}
+
+
+func (m *Mapper001) CpuMapRead(addr uint16, mapped_addr *uint32, data *uint8) bool {
+	if addr >= 0x8000 {
+		outer := m.prgOuterBank()
+		bank := uint32(m.nPRGBankSelect & 0x0F) % m.prgBankCount()  // smaller ROMs mirror
+
+		switch (m.nControlRegister >> 2) & 0x03 {
+		case 0, 1:  // switch 32K at $8000, low bit of bank number ignored
+			*mapped_addr = (outer | (bank & 0x0E)) * 0x4000 + uint32(addr & 0x7FFF)
+		case 2:  // first bank fixed at $8000, switch 16K at $C000
+			if addr <= 0xBFFF {
+				*mapped_addr = outer * 0x4000 + uint32(addr & 0x3FFF)
+			} else {
+				*mapped_addr = (outer | bank) * 0x4000 + uint32(addr & 0x3FFF)
+			}
+		case 3:  // switch 16K at $8000, last bank fixed at $C000
+			if addr <= 0xBFFF {
+				*mapped_addr = (outer | bank) * 0x4000 + uint32(addr & 0x3FFF)
+			} else {
+				last := m.prgBankCount() - 1
+				*mapped_addr = (outer | last) * 0x4000 + uint32(addr & 0x3FFF)
+			}
+		}
+		return true
+	}
+
+	return false
+}
+
+
+func (m *Mapper001) CpuMapWrite(addr uint16, mapped_addr *uint32, data uint8) bool {
+	if addr >= 0x8000 && m.nWriteCooldown > 0 {
+		// writes on consecutive cycles (the two writes of a read-modify-write
+		// instruction) only see the first, some games rely on this
+		return false
+	}
+
+	if addr >= 0x8000 {
+		m.nWriteCooldown = 2
+		if data & 0x80 != 0 {  // reset the shift register and lock PRG to mode 3
+			m.nLoadRegister = 0x00
+			m.nLoadRegisterCount = 0
+			m.nControlRegister |= 0x0C
+		} else {
+			// load data serially into the shift register, LSB first
+			m.nLoadRegister >>= 1
+			m.nLoadRegister |= (data & 0x01) << 4
+			m.nLoadRegisterCount++
+
+			if m.nLoadRegisterCount == 5 {
+				// the address of the 5th write selects the target register
+				switch (addr >> 13) & 0x03 {
+				case 0:  // $8000-$9FFF
+					m.nControlRegister = m.nLoadRegister & 0x1F
+				case 1:  // $A000-$BFFF
+					m.nCHRBankSelect0 = m.nLoadRegister & 0x1F
+				case 2:  // $C000-$DFFF
+					m.nCHRBankSelect1 = m.nLoadRegister & 0x1F
+				case 3:  // $E000-$FFFF
+					m.nPRGBankSelect = m.nLoadRegister & 0x1F
+				}
+
+				m.nLoadRegister = 0x00
+				m.nLoadRegisterCount = 0
+			}
+		}
+	}
+
+	// registers only, nothing gets written to PRG-ROM
+	return false
+}
+
+
+// SOROM/SXROM boards bank their 16K/32K of PRG-RAM with bits 2-3 of the
+// CHR bank register, the cartridge wraps this to the RAM actually present
+func (m *Mapper001) PrgRamMapRead(addr uint16, mapped_addr *uint32) bool {
+	if !m.prgRamEnabled() {
+		return false
+	}
+	*mapped_addr = uint32((m.nCHRBankSelect0 >> 2) & 0x03) * 0x2000 + uint32(addr & 0x1FFF)
+	return true
+}
+
+
+func (m *Mapper001) PrgRamMapWrite(addr uint16, mapped_addr *uint32) bool {
+	return m.PrgRamMapRead(addr, mapped_addr)
+}
+
+
+func (m *Mapper001) mapChr(addr uint16) uint32 {
+	// CHR-RAM boards still bank in 4K units over their 8K of RAM
+	nBanks4K := uint32(m.numChrBanks) * 2
+	if nBanks4K == 0 {
+		nBanks4K = 2
+	}
+
+	var bank uint32
+	if m.nControlRegister & 0x10 != 0 {  // two separate 4K banks
+		if addr <= 0x0FFF {
+			bank = uint32(m.nCHRBankSelect0)
+		} else {
+			bank = uint32(m.nCHRBankSelect1)
+		}
+	} else {  // one 8K bank, low bit ignored
+		bank = uint32(m.nCHRBankSelect0 & 0x1E) | uint32((addr >> 12) & 0x01)
+	}
+
+	return (bank % nBanks4K) * 0x1000 + uint32(addr & 0x0FFF)
+}
+
+
+func (m *Mapper001) PpuMapRead(addr uint16, mapped_addr *uint32) bool {
+	if addr < 0x2000 {
+		*mapped_addr = m.mapChr(addr)
+		return true
+	}
+	return false
+}
+
+
+func (m *Mapper001) PpuMapWrite(addr uint16, mapped_addr *uint32) bool {
+	if addr < 0x2000 {
+		if m.numChrBanks == 0 {  // CHR-RAM
+			*mapped_addr = m.mapChr(addr)
+			return true
+		}
+	}
+	return false
+}
+
+
+// Counts down the serial port's write cooldown. The CPU runs a whole
+// instruction at once so both writes of a read-modify-write land before this
+func (m *Mapper001) CpuClock() {
+	if m.nWriteCooldown > 0 {
+		m.nWriteCooldown--
+	}
+}
+
+
+func (m *Mapper001) Mirror() int {
+	switch m.nControlRegister & 0x03 {
+	case 0:
+		return ONESCREEN_LO
+	case 1:
+		return ONESCREEN_HI
+	case 2:
+		return VERTICAL
+	}
+	return HORIZONTAL
+}
+
+
+func (m *Mapper001) Reset() {
+	m.nLoadRegister = 0x00
+	m.nLoadRegisterCount = 0
+	m.nControlRegister = 0x1C
+	m.nCHRBankSelect0 = 0
+	m.nCHRBankSelect1 = 0
+	m.nPRGBankSelect = 0
+	m.nWriteCooldown = 0
+}
@@ -1,13 +1,20 @@
 package emu
 
 
+func init() {
+	RegisterMapper(2, ANY_SUBMAPPER, func(info RomInfo, mem MapperMemory) (MapperInterface, error) {
+		return NewMapper_002(romBanks(info)), nil
+	})
+}
+
+
 type Mapper002 struct {
 	Mapper
-	nPRGBankSelectLo uint8
-	nPRGBankSelectHi uint8
+	nPRGBankSelectLo uint16
+	nPRGBankSelectHi uint16
 }
 
-func NewMapper_002(prgBanks uint8, chrBanks uint8) *Mapper002 {
+func NewMapper_002(prgBanks uint16, chrBanks uint16) *Mapper002 {
 	mapper := Mapper002{}
 	mapper.numPrgBanks = prgBanks
 	mapper.numChrBanks = chrBanks
@@ -32,7 +39,7 @@ func (m *Mapper002) CpuMapRead(addr uint16, mapped_addr *uint32, data *uint8) bo
 
 func (mapper *Mapper002) CpuMapWrite(addr uint16, mapped_addr *uint32, data uint8) bool {
 	if addr >= 0x8000 && addr <= 0xFFFF {
-		mapper.nPRGBankSelectLo = data & 0x0F
+		mapper.nPRGBankSelectLo = uint16(data & 0x0F)
 	}
 	return false
 }
@@ -57,6 +64,10 @@ func (mapper *Mapper002) PpuMapWrite(addr uint16, mapped_addr *uint32) bool {
 	return false
 }
 
+func (mapper *Mapper002) BusConflicts() bool {
+	return true
+}
+
 func (mapper *Mapper002) Reset() {
 	mapper.nPRGBankSelectLo = 0
 	if mapper.numPrgBanks > 0 {
@@ -0,0 +1,79 @@
+package emu
+
+
+func init() {
+	RegisterMapper(3, ANY_SUBMAPPER, func(info RomInfo, mem MapperMemory) (MapperInterface, error) {
+		return NewMapper_003(romBanks(info)), nil
+	})
+}
+
+
+// CNROM, fixed PRG with a switchable 8K CHR bank
+type Mapper003 struct {
+	Mapper
+	nCHRBankSelect uint8
+}
+
+func NewMapper_003(prgBanks uint16, chrBanks uint16) *Mapper003 {
+	mapper := Mapper003{}
+	mapper.numPrgBanks = prgBanks
+	mapper.numChrBanks = chrBanks
+
+	return &mapper
+}
+
+func (mapper *Mapper003) CpuMapRead(addr uint16, mapped_addr *uint32, data *uint8) bool {
+	if addr >= 0x8000 && addr <= 0xFFFF {
+		if mapper.numPrgBanks > 1 {
+			*mapped_addr = uint32(addr & 0x7FFF)
+		} else {
+			*mapped_addr = uint32(addr & 0x3FFF)
+		}
+		return true
+	}
+	return false
+}
+
+
+func (mapper *Mapper003) CpuMapWrite(addr uint16, mapped_addr *uint32, data uint8) bool {
+	if addr >= 0x8000 && addr <= 0xFFFF {
+		mapper.nCHRBankSelect = data
+	}
+	return false
+}
+
+
+func (mapper *Mapper003) PpuMapRead(addr uint16, mapped_addr *uint32) bool {
+	if addr < 0x2000 {
+		bank := uint32(mapper.nCHRBankSelect)
+		if mapper.numChrBanks > 0 {
+			bank %= uint32(mapper.numChrBanks)
+		} else {
+			bank = 0
+		}
+		*mapped_addr = bank * 0x2000 + uint32(addr)
+		return true
+	}
+	return false
+}
+
+
+func (mapper *Mapper003) PpuMapWrite(addr uint16, mapped_addr *uint32) bool {
+	if addr < 0x2000 {
+		if mapper.numChrBanks == 0 {
+			*mapped_addr = uint32(addr)
+			return true
+		}
+	}
+	return false
+}
+
+
+func (mapper *Mapper003) BusConflicts() bool {
+	return true
+}
+
+
+func (mapper *Mapper003) Reset() {
+	mapper.nCHRBankSelect = 0
+}
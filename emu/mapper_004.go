@@ -0,0 +1,263 @@
+package emu
+
+
+func init() {
+	RegisterMapper(4, ANY_SUBMAPPER, func(info RomInfo, mem MapperMemory) (MapperInterface, error) {
+		return NewMapper_004(romBanks(info)), nil
+	})
+}
+
+
+// number of PPU cycles A12 must be held low before a rising edge clocks
+// the IRQ counter, this filters out the rapid toggles during sprite fetches
+const mmc3A12Filter = 10
+
+
+// MMC3 (TxROM boards)
+type Mapper004 struct {
+	Mapper
+	nTargetRegister uint8
+	bPRGBankMode bool
+	bCHRInversion bool
+	pRegister [8]uint32
+	pPRGBank [4]uint32  // offsets of the four 8K PRG windows
+	pCHRBank [8]uint32  // offsets of the eight 1K CHR windows
+	mirror int
+
+	bPRGRamEnable bool
+	bPRGRamProtect bool
+
+	nIRQCounter uint8
+	nIRQReload uint8
+	bIRQReloadPending bool
+	bIRQEnable bool
+	bIRQActive bool
+
+	bA12 bool  // last seen level of PPU address line 12
+	nA12LowSince uint64  // PPU clock at which A12 last went low
+}
+
+func NewMapper_004(prgBanks uint16, chrBanks uint16) *Mapper004 {
+	mapper := Mapper004{}
+	mapper.numPrgBanks = prgBanks
+	mapper.numChrBanks = chrBanks
+
+	return &mapper
+}
+
+
+func (m *Mapper004) prgBanks8K() uint32 {
+	return uint32(m.numPrgBanks) * 2
+}
+
+
+func (m *Mapper004) chrBanks1K() uint32 {
+	if m.numChrBanks == 0 {
+		return 8  // 8K of CHR-RAM
+	}
+	return uint32(m.numChrBanks) * 8
+}
+
+
+// Recalculates the PRG and CHR windows from the bank registers
+func (m *Mapper004) updateBanks() {
+	nPrg := m.prgBanks8K()
+	nChr := m.chrBanks1K()
+
+	prg := func(bank uint32) uint32 { return (bank % nPrg) * 0x2000 }
+	chr := func(bank uint32) uint32 { return (bank % nChr) * 0x0400 }
+
+	if m.bCHRInversion {  // 1K banks at $0000, 2K banks at $1000
+		m.pCHRBank[0] = chr(m.pRegister[2])
+		m.pCHRBank[1] = chr(m.pRegister[3])
+		m.pCHRBank[2] = chr(m.pRegister[4])
+		m.pCHRBank[3] = chr(m.pRegister[5])
+		m.pCHRBank[4] = chr(m.pRegister[0] & 0xFE)
+		m.pCHRBank[5] = chr(m.pRegister[0] | 0x01)
+		m.pCHRBank[6] = chr(m.pRegister[1] & 0xFE)
+		m.pCHRBank[7] = chr(m.pRegister[1] | 0x01)
+	} else {  // 2K banks at $0000, 1K banks at $1000
+		m.pCHRBank[0] = chr(m.pRegister[0] & 0xFE)
+		m.pCHRBank[1] = chr(m.pRegister[0] | 0x01)
+		m.pCHRBank[2] = chr(m.pRegister[1] & 0xFE)
+		m.pCHRBank[3] = chr(m.pRegister[1] | 0x01)
+		m.pCHRBank[4] = chr(m.pRegister[2])
+		m.pCHRBank[5] = chr(m.pRegister[3])
+		m.pCHRBank[6] = chr(m.pRegister[4])
+		m.pCHRBank[7] = chr(m.pRegister[5])
+	}
+
+	if m.bPRGBankMode {  // $8000 fixed to second last bank
+		m.pPRGBank[0] = prg(nPrg - 2)
+		m.pPRGBank[2] = prg(m.pRegister[6] & 0x3F)
+	} else {  // $C000 fixed to second last bank
+		m.pPRGBank[0] = prg(m.pRegister[6] & 0x3F)
+		m.pPRGBank[2] = prg(nPrg - 2)
+	}
+	m.pPRGBank[1] = prg(m.pRegister[7] & 0x3F)
+	m.pPRGBank[3] = prg(nPrg - 1)
+}
+
+
+func (m *Mapper004) CpuMapRead(addr uint16, mapped_addr *uint32, data *uint8) bool {
+	if addr >= 0x8000 {
+		*mapped_addr = m.pPRGBank[(addr >> 13) & 0x03] + uint32(addr & 0x1FFF)
+		return true
+	}
+
+	return false
+}
+
+
+func (m *Mapper004) CpuMapWrite(addr uint16, mapped_addr *uint32, data uint8) bool {
+	even := addr & 0x0001 == 0
+
+	switch {
+	case addr >= 0x8000 && addr <= 0x9FFF:  // bank select / bank data
+		if even {
+			m.nTargetRegister = data & 0x07
+			m.bPRGBankMode = data & 0x40 != 0
+			m.bCHRInversion = data & 0x80 != 0
+		} else {
+			m.pRegister[m.nTargetRegister] = uint32(data)
+		}
+		m.updateBanks()
+
+	case addr >= 0xA000 && addr <= 0xBFFF:  // mirroring / PRG-RAM protect
+		if even {
+			if data & 0x01 != 0 {
+				m.mirror = HORIZONTAL
+			} else {
+				m.mirror = VERTICAL
+			}
+		} else {
+			m.bPRGRamEnable = data & 0x80 != 0
+			m.bPRGRamProtect = data & 0x40 != 0
+		}
+
+	case addr >= 0xC000 && addr <= 0xDFFF:  // IRQ latch / IRQ reload
+		if even {
+			m.nIRQReload = data
+		} else {
+			m.nIRQCounter = 0
+			m.bIRQReloadPending = true
+		}
+
+	case addr >= 0xE000:  // IRQ disable / IRQ enable
+		if even {
+			m.bIRQEnable = false
+			m.bIRQActive = false  // disabling also acknowledges a pending IRQ
+		} else {
+			m.bIRQEnable = true
+		}
+	}
+
+	// registers only, nothing gets written to PRG-ROM
+	return false
+}
+
+
+func (m *Mapper004) PrgRamMapRead(addr uint16, mapped_addr *uint32) bool {
+	if !m.bPRGRamEnable {
+		return false
+	}
+	*mapped_addr = uint32(addr & 0x1FFF)
+	return true
+}
+
+
+func (m *Mapper004) PrgRamMapWrite(addr uint16, mapped_addr *uint32) bool {
+	if !m.bPRGRamEnable || m.bPRGRamProtect {
+		return false
+	}
+	*mapped_addr = uint32(addr & 0x1FFF)
+	return true
+}
+
+
+func (m *Mapper004) PpuMapRead(addr uint16, mapped_addr *uint32) bool {
+	if addr < 0x2000 {
+		*mapped_addr = m.pCHRBank[addr >> 10] + uint32(addr & 0x03FF)
+		return true
+	}
+	return false
+}
+
+
+func (m *Mapper004) PpuMapWrite(addr uint16, mapped_addr *uint32) bool {
+	if addr < 0x2000 {
+		if m.numChrBanks == 0 {  // CHR-RAM
+			*mapped_addr = m.pCHRBank[addr >> 10] + uint32(addr & 0x03FF)
+			return true
+		}
+	}
+	return false
+}
+
+
+// Watches PPU A12 and clocks the scanline counter on filtered rising edges
+func (m *Mapper004) PpuBusAddress(addr uint16, ppuClock uint64) {
+	a12 := addr & 0x1000 != 0
+
+	if a12 && !m.bA12 {
+		if ppuClock - m.nA12LowSince >= mmc3A12Filter {
+			m.clockIRQCounter()
+		}
+	} else if !a12 && m.bA12 {
+		m.nA12LowSince = ppuClock
+	}
+
+	m.bA12 = a12
+}
+
+
+func (m *Mapper004) clockIRQCounter() {
+	if m.nIRQCounter == 0 || m.bIRQReloadPending {
+		m.nIRQCounter = m.nIRQReload
+		m.bIRQReloadPending = false
+	} else {
+		m.nIRQCounter--
+	}
+
+	if m.nIRQCounter == 0 && m.bIRQEnable {
+		m.bIRQActive = true
+	}
+}
+
+
+func (m *Mapper004) IrqPending() bool {
+	return m.bIRQActive
+}
+
+
+func (m *Mapper004) IrqAcknowledge() {
+	m.bIRQActive = false
+}
+
+
+func (m *Mapper004) Mirror() int {
+	return m.mirror
+}
+
+
+func (m *Mapper004) Reset() {
+	m.nTargetRegister = 0
+	m.bPRGBankMode = false
+	m.bCHRInversion = false
+	m.mirror = HARDWARE
+
+	m.bPRGRamEnable = true
+	m.bPRGRamProtect = false
+
+	m.nIRQCounter = 0
+	m.nIRQReload = 0
+	m.bIRQReloadPending = false
+	m.bIRQEnable = false
+	m.bIRQActive = false
+
+	m.bA12 = false
+	m.nA12LowSince = 0
+
+	m.pRegister = [8]uint32{0, 2, 4, 5, 6, 7, 0, 1}
+	m.updateBanks()
+}
@@ -0,0 +1,558 @@
+package emu
+
+
+func init() {
+	RegisterMapper(5, ANY_SUBMAPPER, func(info RomInfo, mem MapperMemory) (MapperInterface, error) {
+		prgBanks, chrBanks := romBanks(info)
+		return NewMapper_005(prgBanks, chrBanks, mem), nil
+	})
+}
+
+
+// The MMC5 spots the end of a scanline by the PPU's dummy nametable fetches,
+// this many CPU cycles without any PPU fetch means rendering has stopped.
+// It is longer than the gap this PPU leaves while it evaluates sprites
+const mmc5IdleCycles = 32
+
+
+// MMC5 (ExROM boards)
+type Mapper005 struct {
+	Mapper
+	mem MapperMemory
+
+	nPRGMode uint8
+	nCHRMode uint8
+	nPRGRamProtect1 uint8
+	nPRGRamProtect2 uint8
+	nPRGRamBank uint8
+	pPRGBank [4]uint8  // $5114-$5117, bit 7 selects ROM over RAM
+	pCHRBank [12]uint16  // $5120-$5127 sprite set A, $5128-$512B background set B
+	nCHRUpper uint8  // upper CHR bank bits, $5130
+	bLastCHRSetB bool  // set B was written last
+	bSprite8x16 bool  // snooped from PPUCTRL
+
+	exRam [1024]uint8
+	nExRamMode uint8
+	nNametableMapping uint8
+	nFillTile uint8
+	nFillAttrib uint8
+
+	nSplitControl uint8
+	nSplitScroll uint8
+	nSplitBank uint8
+
+	nIRQCompare uint8
+	bIRQEnable bool
+	bIRQPending bool
+	bInFrame bool
+	nScanline uint8
+
+	// scanline detection and per tile state
+	nLastNametableAddr uint16
+	nNametableRepeat int
+	nIdleCycles int
+	nTileFetch int
+	bSplitTile bool
+	nSplitColumn uint16
+	nSplitRow uint16
+	nSplitFineY uint16
+	nExAttrib uint8
+
+	nMultiplicand uint8
+	nMultiplier uint8
+}
+
+func NewMapper_005(prgBanks uint16, chrBanks uint16, mem MapperMemory) *Mapper005 {
+	mapper := Mapper005{}
+	mapper.numPrgBanks = prgBanks
+	mapper.numChrBanks = chrBanks
+	mapper.mem = mem
+
+	return &mapper
+}
+
+
+// Returns the 8K bank and ROM/RAM select for a $8000-$FFFF address
+func (m *Mapper005) prgWindow(addr uint16) (uint32, bool) {
+	slot := (addr >> 13) & 0x03
+	var reg uint8
+	var bank uint32
+
+	switch m.nPRGMode {
+	case 0:  // 32K from $5117
+		reg = m.pPRGBank[3]
+		bank = uint32(reg & 0x7C) | uint32(slot)
+		return bank, true
+	case 1:  // 16K from $5115 and $5117
+		if slot < 2 {
+			reg = m.pPRGBank[1]
+		} else {
+			reg = m.pPRGBank[3]
+		}
+		bank = uint32(reg & 0x7E) | uint32(slot & 0x01)
+	case 2:  // 16K from $5115, 8K from $5116 and $5117
+		if slot < 2 {
+			reg = m.pPRGBank[1]
+			bank = uint32(reg & 0x7E) | uint32(slot & 0x01)
+		} else {
+			reg = m.pPRGBank[slot]
+			bank = uint32(reg & 0x7F)
+		}
+	case 3:  // four 8K banks
+		reg = m.pPRGBank[slot]
+		bank = uint32(reg & 0x7F)
+	}
+
+	// $E000-$FFFF is always ROM
+	return bank, reg & 0x80 != 0 || slot == 3
+}
+
+
+func (m *Mapper005) prgRamWritable() bool {
+	return m.nPRGRamProtect1 == 0x02 && m.nPRGRamProtect2 == 0x01
+}
+
+
+func (m *Mapper005) CpuMapRead(addr uint16, mapped_addr *uint32, data *uint8) bool {
+	switch {
+	case addr == 0x5204:  // IRQ status, reading acknowledges
+		*data = Btoi(m.bIRQPending) << 7 | Btoi(m.bInFrame) << 6
+		m.bIRQPending = false
+		*mapped_addr = MAPPER_HANDLED
+		return true
+	case addr == 0x5205:
+		*data = uint8(uint16(m.nMultiplicand) * uint16(m.nMultiplier))
+		*mapped_addr = MAPPER_HANDLED
+		return true
+	case addr == 0x5206:
+		*data = uint8((uint16(m.nMultiplicand) * uint16(m.nMultiplier)) >> 8)
+		*mapped_addr = MAPPER_HANDLED
+		return true
+	case addr >= 0x5C00 && addr <= 0x5FFF:
+		if m.nExRamMode < 2 {
+			return false  // not readable while used by the PPU
+		}
+		*data = m.exRam[addr & 0x03FF]
+		*mapped_addr = MAPPER_HANDLED
+		return true
+	case addr == 0xFFFA || addr == 0xFFFB:
+		// the NMI vector fetch marks the end of the frame
+		m.bInFrame = false
+	}
+
+	if addr >= 0x8000 {
+		bank, rom := m.prgWindow(addr)
+		if rom {
+			*mapped_addr = (bank % (uint32(m.numPrgBanks) * 2)) * 0x2000 + uint32(addr & 0x1FFF)
+		} else {
+			*mapped_addr = MAPPER_PRG_RAM | ((bank & 0x07) * 0x2000 + uint32(addr & 0x1FFF))
+		}
+		return true
+	}
+
+	return false
+}
+
+
+func (m *Mapper005) CpuMapWrite(addr uint16, mapped_addr *uint32, data uint8) bool {
+	switch {
+	// the PPU registers are mirrored every 8 bytes up to $3FFF
+	case addr >= 0x2000 && addr <= 0x3FFF && addr & 0x0007 == 0:  // PPUCTRL, watched for the sprite size
+		m.bSprite8x16 = data & 0x20 != 0
+	case addr >= 0x2000 && addr <= 0x3FFF && addr & 0x0007 == 1:  // PPUMASK, rendering off ends the frame
+		if data & 0x18 == 0 {
+			m.bInFrame = false
+		}
+
+	case addr == 0x5100:
+		m.nPRGMode = data & 0x03
+	case addr == 0x5101:
+		m.nCHRMode = data & 0x03
+	case addr == 0x5102:
+		m.nPRGRamProtect1 = data & 0x03
+	case addr == 0x5103:
+		m.nPRGRamProtect2 = data & 0x03
+	case addr == 0x5104:
+		m.nExRamMode = data & 0x03
+	case addr == 0x5105:
+		m.nNametableMapping = data
+	case addr == 0x5106:
+		m.nFillTile = data
+	case addr == 0x5107:
+		m.nFillAttrib = data & 0x03
+	case addr == 0x5113:
+		m.nPRGRamBank = data & 0x07
+	case addr >= 0x5114 && addr <= 0x5117:
+		m.pPRGBank[addr - 0x5114] = data
+	case addr >= 0x5120 && addr <= 0x512B:
+		m.pCHRBank[addr - 0x5120] = uint16(data) | uint16(m.nCHRUpper) << 8
+		m.bLastCHRSetB = addr >= 0x5128
+	case addr == 0x5130:
+		m.nCHRUpper = data & 0x03
+
+	case addr == 0x5200:
+		m.nSplitControl = data
+	case addr == 0x5201:
+		m.nSplitScroll = data
+	case addr == 0x5202:
+		m.nSplitBank = data
+	case addr == 0x5203:
+		m.nIRQCompare = data
+	case addr == 0x5204:
+		m.bIRQEnable = data & 0x80 != 0
+	case addr == 0x5205:
+		m.nMultiplicand = data
+	case addr == 0x5206:
+		m.nMultiplier = data
+
+	case addr >= 0x5C00 && addr <= 0x5FFF:
+		switch m.nExRamMode {
+		case 0, 1:  // only writable while rendering, otherwise zero gets written
+			if !m.bInFrame {
+				data = 0
+			}
+			m.exRam[addr & 0x03FF] = data
+		case 2:
+			m.exRam[addr & 0x03FF] = data
+		}
+		*mapped_addr = MAPPER_HANDLED
+		return true
+
+	case addr >= 0x8000:
+		bank, rom := m.prgWindow(addr)
+		if !rom && m.prgRamWritable() {
+			*mapped_addr = MAPPER_PRG_RAM | ((bank & 0x07) * 0x2000 + uint32(addr & 0x1FFF))
+			return true
+		}
+	}
+
+	// registers only, nothing gets written to PRG-ROM
+	return false
+}
+
+
+func (m *Mapper005) PrgRamMapRead(addr uint16, mapped_addr *uint32) bool {
+	*mapped_addr = uint32(m.nPRGRamBank) * 0x2000 + uint32(addr & 0x1FFF)
+	return true
+}
+
+
+func (m *Mapper005) PrgRamMapWrite(addr uint16, mapped_addr *uint32) bool {
+	if !m.prgRamWritable() {
+		return false
+	}
+	return m.PrgRamMapRead(addr, mapped_addr)
+}
+
+
+// Maps a pattern table address through sprite set A or background set B,
+// set B only has four registers so it repeats across both pattern tables
+func (m *Mapper005) mapChr(addr uint16, setB bool) uint32 {
+	slot := uint32(addr >> 10) & 0x07
+	var page uint32
+
+	if setB {
+		b := m.pCHRBank[8:]
+		switch m.nCHRMode {
+		case 0:
+			page = uint32(b[3]) * 8 + slot
+		case 1:
+			page = uint32(b[3]) * 4 + slot % 4
+		case 2:
+			page = uint32(b[(slot % 4) & 0x02 | 0x01]) * 2 + slot % 2
+		case 3:
+			page = uint32(b[slot % 4])
+		}
+	} else {
+		a := m.pCHRBank[:8]
+		switch m.nCHRMode {
+		case 0:
+			page = uint32(a[7]) * 8 + slot
+		case 1:
+			page = uint32(a[slot & 0x04 | 0x03]) * 4 + slot % 4
+		case 2:
+			page = uint32(a[slot | 0x01]) * 2 + slot % 2
+		case 3:
+			page = uint32(a[slot])
+		}
+	}
+
+	return (page * 0x0400 + uint32(addr & 0x03FF)) % uint32(len(m.mem.Chr))
+}
+
+
+// With 8x16 sprites the two sets split between sprites and background,
+// otherwise whichever set was written last is used for everything
+func (m *Mapper005) useSetB(kind int) bool {
+	if m.bSprite8x16 {
+		switch kind {
+		case PPU_FETCH_BACKGROUND:
+			return true
+		case PPU_FETCH_SPRITE:
+			return false
+		}
+	}
+	return m.bLastCHRSetB
+}
+
+
+func (m *Mapper005) PpuMapRead(addr uint16, mapped_addr *uint32) bool {
+	if addr < 0x2000 {
+		*mapped_addr = m.mapChr(addr, m.useSetB(PPU_FETCH_CPU))
+		return true
+	}
+	return false
+}
+
+
+func (m *Mapper005) PpuMapWrite(addr uint16, mapped_addr *uint32) bool {
+	if addr < 0x2000 && m.numChrBanks == 0 {  // CHR-RAM
+		*mapped_addr = m.mapChr(addr, m.useSetB(PPU_FETCH_CPU))
+		return true
+	}
+	return false
+}
+
+
+// $5105 gives each nametable quadrant a source: CIRAM page 0 or 1, ExRAM or fill mode
+func (m *Mapper005) nametableSource(addr uint16) uint8 {
+	return (m.nNametableMapping >> (((addr >> 10) & 0x03) * 2)) & 0x03
+}
+
+
+// ExRAM and fill mode are served by PpuFetch/PpuStore, this only sees CIRAM quadrants
+func (m *Mapper005) MapNametable(addr uint16, ciram *[2][1024]uint8) ([]uint8, bool) {
+	return ciram[m.nametableSource(addr) & 0x01][:], true
+}
+
+
+func (m *Mapper005) readNametable(addr uint16, data *uint8) bool {
+	switch m.nametableSource(addr) {
+	case 2:  // ExRAM
+		if m.nExRamMode < 2 {
+			*data = m.exRam[addr & 0x03FF]
+		} else {
+			*data = 0
+		}
+		return true
+	case 3:  // fill mode
+		if addr & 0x03FF >= 0x03C0 {
+			*data = m.nFillAttrib * 0x55
+		} else {
+			*data = m.nFillTile
+		}
+		return true
+	}
+	return false  // CIRAM
+}
+
+
+// Counts scanlines by watching for the PPU reading the same nametable byte
+// three times in a row, which only happens at the end of each line
+func (m *Mapper005) detectScanline(addr uint16, kind int) bool {
+	detected := false
+	if kind == PPU_FETCH_NAMETABLE && addr == m.nLastNametableAddr {
+		m.nNametableRepeat++
+		if m.nNametableRepeat == 2 {
+			m.startScanline()
+			detected = true
+		}
+	} else {
+		m.nNametableRepeat = 0
+	}
+
+	if kind == PPU_FETCH_NAMETABLE {
+		m.nLastNametableAddr = addr
+	} else {
+		m.nLastNametableAddr = 0
+	}
+	return detected
+}
+
+
+func (m *Mapper005) startScanline() {
+	if !m.bInFrame {
+		m.bInFrame = true
+		m.nScanline = 0
+		m.bIRQPending = false
+	} else {
+		m.nScanline++
+		if m.nScanline == m.nIRQCompare {
+			m.bIRQPending = true
+		}
+	}
+	m.nTileFetch = 0
+}
+
+
+// Works out if the tile being fetched falls in the vertical split region.
+// The first 32 fetches of a line are its tiles 2-33, the two after that
+// are tiles 0 and 1 of the next line
+func (m *Mapper005) updateSplit() {
+	fetch := m.nTileFetch
+	m.nTileFetch++
+
+	column := uint16(fetch + 2) & 0x1F
+	line := uint16(m.nScanline)
+	if fetch >= 32 {
+		column = uint16(fetch - 32) & 0x1F
+		line++
+	}
+
+	threshold := uint16(m.nSplitControl & 0x1F)
+	if m.nSplitControl & 0x40 != 0 {  // split on the right
+		m.bSplitTile = column >= threshold
+	} else {
+		m.bSplitTile = column < threshold
+	}
+	m.bSplitTile = m.bSplitTile && m.nSplitControl & 0x80 != 0 && m.nExRamMode < 2
+	if !m.bSplitTile {
+		return
+	}
+
+	y := (uint16(m.nSplitScroll) + line) % 240
+	m.nSplitColumn = column
+	m.nSplitRow = y / 8
+	m.nSplitFineY = y & 0x07
+}
+
+
+func (m *Mapper005) PpuFetch(addr uint16, kind int, data *uint8) bool {
+	if kind == PPU_FETCH_CPU {
+		if addr >= 0x2000 {
+			return m.readNametable(addr, data)
+		}
+		return false  // pattern reads go through PpuMapRead
+	}
+
+	m.nIdleCycles = 0
+	if m.detectScanline(addr, kind) {
+		return m.readNametable(addr, data)
+	}
+
+	switch kind {
+	case PPU_FETCH_NAMETABLE:
+		m.updateSplit()
+		if m.bSplitTile {
+			*data = m.exRam[m.nSplitRow * 32 + m.nSplitColumn]
+			return true
+		}
+		if m.nExRamMode == 1 {
+			m.nExAttrib = m.exRam[addr & 0x03FF]
+		}
+		return m.readNametable(addr, data)
+
+	case PPU_FETCH_ATTRIBUTE:
+		if m.bSplitTile {
+			attr := m.exRam[0x03C0 + (m.nSplitRow / 4) * 8 + m.nSplitColumn / 4]
+			shift := (m.nSplitRow & 0x02) << 1 | (m.nSplitColumn & 0x02)
+			*data = ((attr >> shift) & 0x03) * 0x55
+			return true
+		}
+		if m.nExRamMode == 1 {  // palette comes from the top bits of the tile's ExRAM byte
+			*data = (m.nExAttrib >> 6) * 0x55
+			return true
+		}
+		return m.readNametable(addr, data)
+
+	case PPU_FETCH_BACKGROUND:
+		var offset uint32
+		switch {
+		case m.bSplitTile:
+			offset = uint32(m.nSplitBank) * 0x1000 + uint32(addr & 0x0FF8 | m.nSplitFineY)
+		case m.nExRamMode == 1:  // 4K bank per tile
+			bank := uint32(m.nExAttrib & 0x3F) | uint32(m.nCHRUpper) << 6
+			offset = bank * 0x1000 + uint32(addr & 0x0FFF)
+		default:
+			offset = m.mapChr(addr, m.useSetB(kind))
+		}
+		*data = m.mem.Chr[offset % uint32(len(m.mem.Chr))]
+		return true
+
+	case PPU_FETCH_SPRITE:
+		*data = m.mem.Chr[m.mapChr(addr, m.useSetB(kind))]
+		return true
+	}
+
+	return false
+}
+
+
+func (m *Mapper005) PpuStore(addr uint16, data uint8) bool {
+	if addr < 0x2000 {
+		return false
+	}
+
+	switch m.nametableSource(addr) {
+	case 2:
+		if m.nExRamMode < 2 {
+			m.exRam[addr & 0x03FF] = data
+		}
+		return true
+	case 3:
+		return true  // fill mode ignores writes
+	}
+	return false
+}
+
+
+func (m *Mapper005) CpuClock() {
+	if !m.bInFrame {
+		return
+	}
+	m.nIdleCycles++
+	if m.nIdleCycles >= mmc5IdleCycles {
+		m.bInFrame = false
+		m.nLastNametableAddr = 0
+		m.nNametableRepeat = 0
+	}
+}
+
+
+func (m *Mapper005) IrqPending() bool {
+	return m.bIRQPending && m.bIRQEnable
+}
+
+
+func (m *Mapper005) IrqAcknowledge() {
+	m.bIRQPending = false
+}
+
+
+func (m *Mapper005) Reset() {
+	m.nPRGMode = 3
+	m.nCHRMode = 0
+	m.nPRGRamProtect1 = 0
+	m.nPRGRamProtect2 = 0
+	m.nPRGRamBank = 0
+	m.pPRGBank = [4]uint8{0xFF, 0xFF, 0xFF, 0xFF}
+	m.pCHRBank = [12]uint16{}
+	m.nCHRUpper = 0
+	m.bLastCHRSetB = false
+	m.bSprite8x16 = false
+
+	m.nExRamMode = 0
+	m.nNametableMapping = 0
+	m.nFillTile = 0
+	m.nFillAttrib = 0
+
+	m.nSplitControl = 0
+	m.nSplitScroll = 0
+	m.nSplitBank = 0
+
+	m.nIRQCompare = 0
+	m.bIRQEnable = false
+	m.bIRQPending = false
+	m.bInFrame = false
+	m.nScanline = 0
+
+	m.nLastNametableAddr = 0
+	m.nNametableRepeat = 0
+	m.nIdleCycles = 0
+	m.nTileFetch = 0
+	m.bSplitTile = false
+	m.nExAttrib = 0
+
+	m.nMultiplicand = 0xFF
+	m.nMultiplier = 0xFF
+}
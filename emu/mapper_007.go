@@ -0,0 +1,80 @@
+package emu
+
+
+func init() {
+	RegisterMapper(7, ANY_SUBMAPPER, func(info RomInfo, mem MapperMemory) (MapperInterface, error) {
+		return NewMapper_007(romBanks(info)), nil
+	})
+}
+
+
+// AxROM, 32K PRG switching with one-screen mirroring
+type Mapper007 struct {
+	Mapper
+	nPRGBankSelect uint8
+	mirror int
+}
+
+func NewMapper_007(prgBanks uint16, chrBanks uint16) *Mapper007 {
+	mapper := Mapper007{}
+	mapper.numPrgBanks = prgBanks
+	mapper.numChrBanks = chrBanks
+
+	return &mapper
+}
+
+func (mapper *Mapper007) CpuMapRead(addr uint16, mapped_addr *uint32, data *uint8) bool {
+	if addr >= 0x8000 && addr <= 0xFFFF {
+		nBanks := uint32(mapper.numPrgBanks) / 2
+		if nBanks == 0 {
+			nBanks = 1
+		}
+		*mapped_addr = (uint32(mapper.nPRGBankSelect) % nBanks) * 0x8000 + uint32(addr & 0x7FFF)
+		return true
+	}
+	return false
+}
+
+
+func (mapper *Mapper007) CpuMapWrite(addr uint16, mapped_addr *uint32, data uint8) bool {
+	if addr >= 0x8000 && addr <= 0xFFFF {
+		mapper.nPRGBankSelect = data & 0x07
+		if data & 0x10 != 0 {
+			mapper.mirror = ONESCREEN_HI
+		} else {
+			mapper.mirror = ONESCREEN_LO
+		}
+	}
+	return false
+}
+
+
+func (mapper *Mapper007) PpuMapRead(addr uint16, mapped_addr *uint32) bool {
+	if addr < 0x2000 {
+		*mapped_addr = uint32(addr)
+		return true
+	}
+	return false
+}
+
+
+func (mapper *Mapper007) PpuMapWrite(addr uint16, mapped_addr *uint32) bool {
+	if addr < 0x2000 {
+		if mapper.numChrBanks == 0 {
+			*mapped_addr = uint32(addr)
+			return true
+		}
+	}
+	return false
+}
+
+
+func (mapper *Mapper007) Mirror() int {
+	return mapper.mirror
+}
+
+
+func (mapper *Mapper007) Reset() {
+	mapper.nPRGBankSelect = 0
+	mapper.mirror = ONESCREEN_LO
+}
@@ -0,0 +1,177 @@
+package emu
+
+
+func init() {
+	RegisterMapper(9, ANY_SUBMAPPER, func(info RomInfo, mem MapperMemory) (MapperInterface, error) {
+		prgBanks, chrBanks := romBanks(info)
+		return NewMapper_009(prgBanks, chrBanks, mem.Chr, false), nil
+	})
+	RegisterMapper(10, ANY_SUBMAPPER, func(info RomInfo, mem MapperMemory) (MapperInterface, error) {
+		prgBanks, chrBanks := romBanks(info)
+		return NewMapper_009(prgBanks, chrBanks, mem.Chr, true), nil
+	})
+}
+
+
+// MMC2 (PxROM, mapper 9) and MMC4 (FxROM, mapper 10). Each 4K pattern
+// table has two banks and a latch that picks between them, the latch flips
+// when the PPU fetches the high plane of tile $FD or $FE. The fetch itself
+// still comes from the old bank, so the mapper serves rendering fetches
+// and updates the latches afterwards
+type Mapper009 struct {
+	Mapper
+	bMMC4 bool  // 16K PRG banking and wider latch triggers
+	chr []uint8
+
+	nPRGBank uint8
+	pCHRBank [2][2]uint8  // [pattern table][latch $FD/$FE]
+	pLatch [2]uint8  // 0 for $FD, 1 for $FE
+	mirror int
+}
+
+func NewMapper_009(prgBanks uint16, chrBanks uint16, chr []uint8, mmc4 bool) *Mapper009 {
+	mapper := Mapper009{}
+	mapper.numPrgBanks = prgBanks
+	mapper.numChrBanks = chrBanks
+	mapper.chr = chr
+	mapper.bMMC4 = mmc4
+
+	return &mapper
+}
+
+
+func (m *Mapper009) CpuMapRead(addr uint16, mapped_addr *uint32, data *uint8) bool {
+	if addr < 0x8000 {
+		return false
+	}
+
+	if m.bMMC4 {
+		// switchable 16K at $8000, last 16K fixed
+		bank := uint32(m.nPRGBank & 0x0F)
+		if addr >= 0xC000 {
+			bank = uint32(m.numPrgBanks) - 1
+		}
+		*mapped_addr = (bank % uint32(m.numPrgBanks)) * 0x4000 + uint32(addr & 0x3FFF)
+		return true
+	}
+
+	// switchable 8K at $8000, last three 8K fixed
+	nPrg := uint32(m.numPrgBanks) * 2
+	bank := uint32(m.nPRGBank & 0x0F)
+	if addr >= 0xA000 {
+		bank = nPrg - 4 + uint32((addr - 0x8000) >> 13)
+	}
+	*mapped_addr = (bank % nPrg) * 0x2000 + uint32(addr & 0x1FFF)
+	return true
+}
+
+
+func (m *Mapper009) CpuMapWrite(addr uint16, mapped_addr *uint32, data uint8) bool {
+	switch addr & 0xF000 {
+	case 0xA000:
+		m.nPRGBank = data
+	case 0xB000:
+		m.pCHRBank[0][0] = data & 0x1F
+	case 0xC000:
+		m.pCHRBank[0][1] = data & 0x1F
+	case 0xD000:
+		m.pCHRBank[1][0] = data & 0x1F
+	case 0xE000:
+		m.pCHRBank[1][1] = data & 0x1F
+	case 0xF000:
+		if data & 0x01 == 0 {
+			m.mirror = VERTICAL
+		} else {
+			m.mirror = HORIZONTAL
+		}
+	}
+
+	// registers only, nothing gets written to PRG-ROM
+	return false
+}
+
+
+func (m *Mapper009) mapChr(addr uint16) uint32 {
+	nChr := uint32(m.numChrBanks) * 2
+	if nChr == 0 {
+		nChr = 2  // 8K of CHR-RAM
+	}
+	table := (addr >> 12) & 0x01
+	bank := uint32(m.pCHRBank[table][m.pLatch[table]])
+	return (bank % nChr) * 0x1000 + uint32(addr & 0x0FFF)
+}
+
+
+func (m *Mapper009) PpuMapRead(addr uint16, mapped_addr *uint32) bool {
+	if addr < 0x2000 {
+		*mapped_addr = m.mapChr(addr)
+		return true
+	}
+	return false
+}
+
+
+func (m *Mapper009) PpuMapWrite(addr uint16, mapped_addr *uint32) bool {
+	if addr < 0x2000 {
+		if m.numChrBanks == 0 {  // CHR-RAM
+			*mapped_addr = m.mapChr(addr)
+			return true
+		}
+	}
+	return false
+}
+
+
+// Pattern fetches made while rendering move the latches. Reads through
+// $2007 also do on hardware but no game depends on it, and leaving them
+// out keeps the debug views from disturbing the latches
+func (m *Mapper009) PpuFetch(addr uint16, kind int, data *uint8) bool {
+	if addr >= 0x2000 || (kind != PPU_FETCH_BACKGROUND && kind != PPU_FETCH_SPRITE) {
+		return false
+	}
+
+	mapped := m.mapChr(addr)
+	if int(mapped) >= len(m.chr) {
+		return false
+	}
+	*data = m.chr[mapped]
+
+	m.updateLatch(addr)
+	return true
+}
+
+
+func (m *Mapper009) PpuStore(addr uint16, data uint8) bool {
+	return false
+}
+
+
+// MMC2 only watches $0FD8 and $0FE8 in the left pattern table, the rest
+// trigger on any row of the tile's high plane
+func (m *Mapper009) updateLatch(addr uint16) {
+	table := (addr >> 12) & 0x01
+	tile := addr & 0x0FF8
+	if table == 0 && !m.bMMC4 {
+		tile = addr & 0x0FFF
+	}
+
+	switch tile {
+	case 0x0FD8:
+		m.pLatch[table] = 0
+	case 0x0FE8:
+		m.pLatch[table] = 1
+	}
+}
+
+
+func (m *Mapper009) Mirror() int {
+	return m.mirror
+}
+
+
+func (m *Mapper009) Reset() {
+	m.nPRGBank = 0
+	m.pCHRBank = [2][2]uint8{}
+	m.pLatch = [2]uint8{1, 1}
+	m.mirror = HARDWARE
+}
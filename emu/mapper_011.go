@@ -0,0 +1,82 @@
+package emu
+
+
+func init() {
+	RegisterMapper(11, ANY_SUBMAPPER, func(info RomInfo, mem MapperMemory) (MapperInterface, error) {
+		return NewMapper_011(romBanks(info)), nil
+	})
+}
+
+
+// Color Dreams, 32K PRG and 8K CHR switching from a single register
+type Mapper011 struct {
+	Mapper
+	nPRGBankSelect uint8
+	nCHRBankSelect uint8
+}
+
+func NewMapper_011(prgBanks uint16, chrBanks uint16) *Mapper011 {
+	mapper := Mapper011{}
+	mapper.numPrgBanks = prgBanks
+	mapper.numChrBanks = chrBanks
+
+	return &mapper
+}
+
+func (mapper *Mapper011) CpuMapRead(addr uint16, mapped_addr *uint32, data *uint8) bool {
+	if addr >= 0x8000 && addr <= 0xFFFF {
+		nBanks := uint32(mapper.numPrgBanks) / 2
+		if nBanks == 0 {
+			nBanks = 1
+		}
+		*mapped_addr = (uint32(mapper.nPRGBankSelect) % nBanks) * 0x8000 + uint32(addr & 0x7FFF)
+		return true
+	}
+	return false
+}
+
+
+func (mapper *Mapper011) CpuMapWrite(addr uint16, mapped_addr *uint32, data uint8) bool {
+	if addr >= 0x8000 && addr <= 0xFFFF {
+		mapper.nPRGBankSelect = data & 0x03
+		mapper.nCHRBankSelect = (data >> 4) & 0x0F
+	}
+	return false
+}
+
+
+func (mapper *Mapper011) PpuMapRead(addr uint16, mapped_addr *uint32) bool {
+	if addr < 0x2000 {
+		bank := uint32(mapper.nCHRBankSelect)
+		if mapper.numChrBanks > 0 {
+			bank %= uint32(mapper.numChrBanks)
+		} else {
+			bank = 0
+		}
+		*mapped_addr = bank * 0x2000 + uint32(addr)
+		return true
+	}
+	return false
+}
+
+
+func (mapper *Mapper011) PpuMapWrite(addr uint16, mapped_addr *uint32) bool {
+	if addr < 0x2000 {
+		if mapper.numChrBanks == 0 {
+			*mapped_addr = uint32(addr)
+			return true
+		}
+	}
+	return false
+}
+
+
+func (mapper *Mapper011) BusConflicts() bool {
+	return true
+}
+
+
+func (mapper *Mapper011) Reset() {
+	mapper.nPRGBankSelect = 0
+	mapper.nCHRBankSelect = 0
+}
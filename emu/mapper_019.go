@@ -0,0 +1,197 @@
+package emu
+
+
+func init() {
+	RegisterMapper(19, ANY_SUBMAPPER, func(info RomInfo, mem MapperMemory) (MapperInterface, error) {
+		prgBanks, chrBanks := romBanks(info)
+		return NewMapper_019(prgBanks, chrBanks, mem.Chr), nil
+	})
+}
+
+
+// Namco 163 (and the audio-less 129), with wavetable expansion audio,
+// a CPU cycle IRQ counter and nametables that can be mapped to CHR-ROM
+type Mapper019 struct {
+	Mapper
+	audio *N163Audio
+	chr []uint8  // CHR-ROM, for the nametable banks
+
+	pCHRBank [8]uint8
+	pNTBank [4]uint8  // $E0 and up selects CIRAM, anything else CHR-ROM
+	pPRGBank [3]uint8  // $8000, $A000 and $C000
+	nWriteProtect uint8  // $F800, RAM writes need $4x with the 2K block's bit clear
+
+	nIRQCounter uint16  // 15 bits, counts up to $7FFF
+	bIRQEnable bool
+	bIRQActive bool
+}
+
+func NewMapper_019(prgBanks uint16, chrBanks uint16, chr []uint8) *Mapper019 {
+	mapper := Mapper019{}
+	mapper.numPrgBanks = prgBanks
+	mapper.numChrBanks = chrBanks
+	mapper.chr = chr
+	mapper.audio = NewN163Audio()
+
+	return &mapper
+}
+
+
+func (m *Mapper019) prgBanks8K() uint32 {
+	return uint32(m.numPrgBanks) * 2
+}
+
+
+func (m *Mapper019) chrBanks1K() uint32 {
+	if m.numChrBanks == 0 {
+		return 8  // 8K of CHR-RAM
+	}
+	return uint32(m.numChrBanks) * 8
+}
+
+
+func (m *Mapper019) CpuMapRead(addr uint16, mapped_addr *uint32, data *uint8) bool {
+	switch {
+	case addr >= 0x4800 && addr <= 0x4FFF:
+		*data = m.audio.ReadData()
+	case addr >= 0x5000 && addr <= 0x57FF:
+		*data = uint8(m.nIRQCounter)
+	case addr >= 0x5800 && addr <= 0x5FFF:
+		*data = uint8(m.nIRQCounter >> 8)
+		if m.bIRQEnable {
+			*data |= 0x80
+		}
+	case addr >= 0x8000:
+		var bank uint32
+		if addr >= 0xE000 {
+			bank = m.prgBanks8K() - 1
+		} else {
+			bank = uint32(m.pPRGBank[(addr - 0x8000) >> 13] & 0x3F)
+		}
+		*mapped_addr = (bank % m.prgBanks8K()) * 0x2000 + uint32(addr & 0x1FFF)
+		return true
+	default:
+		return false
+	}
+
+	*mapped_addr = MAPPER_HANDLED
+	return true
+}
+
+
+func (m *Mapper019) CpuMapWrite(addr uint16, mapped_addr *uint32, data uint8) bool {
+	switch {
+	case addr >= 0x4800 && addr <= 0x4FFF:
+		m.audio.WriteData(data)
+	case addr >= 0x5000 && addr <= 0x57FF:
+		m.nIRQCounter = m.nIRQCounter & 0x7F00 | uint16(data)
+		m.bIRQActive = false
+	case addr >= 0x5800 && addr <= 0x5FFF:
+		m.nIRQCounter = m.nIRQCounter & 0x00FF | uint16(data & 0x7F) << 8
+		m.bIRQEnable = data & 0x80 != 0
+		m.bIRQActive = false
+	case addr >= 0x8000 && addr <= 0xBFFF:
+		m.pCHRBank[(addr - 0x8000) >> 11] = data
+	case addr >= 0xC000 && addr <= 0xDFFF:
+		m.pNTBank[(addr - 0xC000) >> 11] = data
+	case addr >= 0xE000 && addr <= 0xE7FF:
+		m.pPRGBank[0] = data & 0x3F
+		m.audio.bDisable = data & 0x40 != 0
+	case addr >= 0xE800 && addr <= 0xEFFF:
+		m.pPRGBank[1] = data & 0x3F  // bits 6-7 are the CIRAM pattern table disables
+	case addr >= 0xF000 && addr <= 0xF7FF:
+		m.pPRGBank[2] = data & 0x3F
+	case addr >= 0xF800:
+		m.nWriteProtect = data
+		m.audio.WriteAddress(data)
+	default:
+		return false
+	}
+
+	*mapped_addr = MAPPER_HANDLED
+	return true
+}
+
+
+func (m *Mapper019) PrgRamMapWrite(addr uint16, mapped_addr *uint32) bool {
+	block := uint8(1) << ((addr - 0x6000) >> 11)
+	if m.nWriteProtect & 0xF0 != 0x40 || m.nWriteProtect & block != 0 {
+		return false
+	}
+	*mapped_addr = uint32(addr & 0x1FFF)
+	return true
+}
+
+
+// CHR banks $E0 and up can put CIRAM in the pattern tables, which no game
+// relies on, so those banks read CHR-ROM like any other
+func (m *Mapper019) PpuMapRead(addr uint16, mapped_addr *uint32) bool {
+	if addr < 0x2000 {
+		*mapped_addr = (uint32(m.pCHRBank[addr >> 10]) % m.chrBanks1K()) * 0x0400 + uint32(addr & 0x03FF)
+		return true
+	}
+	return false
+}
+
+
+func (m *Mapper019) PpuMapWrite(addr uint16, mapped_addr *uint32) bool {
+	if addr < 0x2000 && m.numChrBanks == 0 {  // CHR-RAM
+		return m.PpuMapRead(addr, mapped_addr)
+	}
+	return false
+}
+
+
+// Each nametable quadrant is either a CIRAM page or a read only 1K of CHR-ROM
+func (m *Mapper019) MapNametable(addr uint16, ciram *[2][1024]uint8) ([]uint8, bool) {
+	bank := m.pNTBank[(addr >> 10) & 0x03]
+	if bank >= 0xE0 || m.numChrBanks == 0 {
+		return ciram[bank & 0x01][:], true
+	}
+
+	offset := (uint32(bank) % m.chrBanks1K()) * 0x0400
+	return m.chr[offset:offset + 0x0400], false
+}
+
+
+// The IRQ counter counts up every CPU cycle and stops once it hits $7FFF
+func (m *Mapper019) CpuClock() {
+	m.audio.Clock()
+
+	if !m.bIRQEnable || m.nIRQCounter == 0x7FFF {
+		return
+	}
+	m.nIRQCounter++
+	if m.nIRQCounter == 0x7FFF {
+		m.bIRQActive = true
+	}
+}
+
+
+func (m *Mapper019) IrqPending() bool {
+	return m.bIRQActive
+}
+
+
+func (m *Mapper019) IrqAcknowledge() {
+	m.bIRQActive = false
+}
+
+
+func (m *Mapper019) ExpansionAudio() []ExpansionAudio {
+	return []ExpansionAudio{m.audio}
+}
+
+
+func (m *Mapper019) Reset() {
+	m.pCHRBank = [8]uint8{}
+	m.pNTBank = [4]uint8{0xE0, 0xE1, 0xE0, 0xE1}
+	m.pPRGBank = [3]uint8{0, 1, 2}
+	m.nWriteProtect = 0
+
+	m.nIRQCounter = 0
+	m.bIRQEnable = false
+	m.bIRQActive = false
+
+	m.audio.Reset()
+}
@@ -0,0 +1,514 @@
+package emu
+
+import (
+	"errors"
+	"sync"
+)
+
+
+// iNES mapper 20 was set aside for the Famicom Disk System. The factory
+// builds the RAM adapter with no disk, LoadFdsCartridge inserts the image
+func init() {
+	RegisterMapper(20, ANY_SUBMAPPER, func(info RomInfo, mem MapperMemory) (MapperInterface, error) {
+		return NewMapper_020(), nil
+	})
+}
+
+
+// CPU cycles between bytes passing under the drive head (96.4kHz bit rate)
+const fdsByteCycles = 150
+// CPU cycles for the head to return to the start of the disk after a rewind
+const fdsRewindCycles = 50000
+// CPU cycles a disk stays out during SwitchDiskSide, games wait to see
+// the drive empty before asking for the next side
+const fdsSwapCycles = 1789773
+
+
+var ErrNoDiskSide = errors.New("disk image has no such side")
+
+
+// The Famicom Disk System RAM adapter: 32K of PRG-RAM at $6000, the BIOS
+// at $E000, 8K of CHR-RAM, a cycle timer IRQ, the disk drive interface
+// and a wavetable sound channel
+type Mapper020 struct {
+	Mapper
+	audio *FdsAudio
+
+	diskLock sync.Mutex  // guards the disk and side against the auto save and frontend goroutines
+	image *fdsImage
+	nSide int  // inserted side, -1 with no disk in the drive
+	bDiskDirty bool  // written to since the last save
+	nSwapSide int  // side to insert once nSwapDelay runs out
+	nSwapDelay int
+	nHeadSide int  // side the drive was last scanning, to notice swaps
+
+	bDiskIO bool  // $4023 bit 0
+	bSoundIO bool  // $4023 bit 1
+
+	nTimerReload uint16
+	nTimerCounter uint16
+	bTimerRepeat bool
+	bTimerEnable bool
+	bTimerIRQ bool
+
+	// $4025 drive control
+	bMotorOn bool
+	bResetTransfer bool
+	bReadMode bool
+	bHorizontal bool
+	bCrcControl bool
+	bDiskReady bool
+	bDiskIRQEnable bool
+
+	bDiskIRQ bool
+	bTransferComplete bool
+	bEndOfHead bool
+	bScanning bool
+	bGapEnded bool
+	nPosition int
+	nDelay int
+	nReadData uint8
+	nWriteData uint8
+	nCrc uint16
+	nCrcBytes int  // CRC bytes written so far while bCrcControl is set
+	nExtOutput uint8  // $4026
+}
+
+func NewMapper_020() *Mapper020 {
+	mapper := Mapper020{}
+	mapper.audio = NewFdsAudio()
+	mapper.nSide = -1
+	mapper.nHeadSide = -1
+
+	return &mapper
+}
+
+
+func (m *Mapper020) insertImage(img *fdsImage) {
+	m.diskLock.Lock()
+	m.image = img
+	m.nSide = 0
+	m.bDiskDirty = false
+	m.diskLock.Unlock()
+}
+
+
+// Number of disk sides in the image
+func (m *Mapper020) DiskSides() int {
+	m.diskLock.Lock()
+	defer m.diskLock.Unlock()
+	if m.image == nil {
+		return 0
+	}
+	return len(m.image.sides)
+}
+
+
+// Side in the drive, -1 when it is empty
+func (m *Mapper020) DiskSide() int {
+	m.diskLock.Lock()
+	defer m.diskLock.Unlock()
+	return m.nSide
+}
+
+
+func (m *Mapper020) EjectDisk() {
+	m.diskLock.Lock()
+	m.nSide = -1
+	m.nSwapDelay = 0
+	m.diskLock.Unlock()
+}
+
+
+// Puts a side in the drive straight away
+func (m *Mapper020) InsertDisk(side int) error {
+	m.diskLock.Lock()
+	defer m.diskLock.Unlock()
+	if m.image == nil || side < 0 || side >= len(m.image.sides) {
+		return ErrNoDiskSide
+	}
+	m.nSide = side
+	m.nSwapDelay = 0
+	return nil
+}
+
+
+// Ejects the disk and inserts side a second later, which is what games
+// expect when they ask for another side
+func (m *Mapper020) SwitchDiskSide(side int) error {
+	m.diskLock.Lock()
+	defer m.diskLock.Unlock()
+	if m.image == nil || side < 0 || side >= len(m.image.sides) {
+		return ErrNoDiskSide
+	}
+	m.nSide = -1
+	m.nSwapSide = side
+	m.nSwapDelay = fdsSwapCycles
+	return nil
+}
+
+
+func (m *Mapper020) CpuMapRead(addr uint16, mapped_addr *uint32, data *uint8) bool {
+	switch {
+	case addr >= 0x4030 && addr <= 0x4033:
+		if !m.bDiskIO {
+			return false
+		}
+		*data = m.readRegister(addr)
+	case addr >= 0x4040 && addr <= 0x409F:
+		if !m.bSoundIO || !m.audio.Read(addr, data) {
+			return false
+		}
+	case addr >= 0x6000 && addr <= 0xDFFF:
+		*mapped_addr = MAPPER_PRG_RAM | uint32(addr - 0x6000)
+		return true
+	case addr >= 0xE000:
+		*mapped_addr = uint32(addr - 0xE000)
+		return true
+	default:
+		return false
+	}
+
+	*mapped_addr = MAPPER_HANDLED
+	return true
+}
+
+
+func (m *Mapper020) readRegister(addr uint16) uint8 {
+	var data uint8
+	switch addr {
+	case 0x4030:  // reading acknowledges both IRQs
+		if m.bTimerIRQ {
+			data |= 0x01
+		}
+		if m.bTransferComplete {
+			data |= 0x02
+		}
+		if m.bEndOfHead {
+			data |= 0x40
+		}
+		m.bTimerIRQ = false
+		m.bDiskIRQ = false
+		m.bTransferComplete = false
+	case 0x4031:
+		data = m.nReadData
+		m.bDiskIRQ = false
+		m.bTransferComplete = false
+	case 0x4032:  // drive status, set bits are bad news
+		data = 0x40
+		m.diskLock.Lock()
+		if m.nSide < 0 {
+			data |= 0x07  // no disk, not ready, write protected
+		} else if !m.bScanning {
+			data |= 0x02
+		}
+		m.diskLock.Unlock()
+	case 0x4033:
+		data = 0x80  // RAM adapter battery is good
+	}
+	return data
+}
+
+
+func (m *Mapper020) CpuMapWrite(addr uint16, mapped_addr *uint32, data uint8) bool {
+	switch {
+	case addr >= 0x4020 && addr <= 0x4026:
+		m.writeRegister(addr, data)
+	case addr >= 0x4040 && addr <= 0x408A:
+		if m.bSoundIO {
+			m.audio.Write(addr, data)
+		}
+	case addr >= 0x6000 && addr <= 0xDFFF:
+		*mapped_addr = MAPPER_PRG_RAM | uint32(addr - 0x6000)
+		return true
+	default:
+		return false
+	}
+
+	*mapped_addr = MAPPER_HANDLED
+	return true
+}
+
+
+func (m *Mapper020) writeRegister(addr uint16, data uint8) {
+	if addr == 0x4023 {
+		m.bDiskIO = data & 0x01 != 0
+		m.bSoundIO = data & 0x02 != 0
+		if !m.bDiskIO {
+			m.bTimerEnable = false
+			m.bTimerIRQ = false
+			m.bDiskIRQ = false
+		}
+		return
+	}
+	if !m.bDiskIO {
+		return
+	}
+
+	switch addr {
+	case 0x4020:
+		m.nTimerReload = m.nTimerReload & 0xFF00 | uint16(data)
+	case 0x4021:
+		m.nTimerReload = m.nTimerReload & 0x00FF | uint16(data) << 8
+	case 0x4022:
+		m.bTimerRepeat = data & 0x01 != 0
+		m.bTimerEnable = data & 0x02 != 0
+		if m.bTimerEnable {
+			m.nTimerCounter = m.nTimerReload
+		} else {
+			m.bTimerIRQ = false
+		}
+	case 0x4024:
+		m.nWriteData = data
+		m.bTransferComplete = false
+		m.bDiskIRQ = false
+	case 0x4025:
+		m.bMotorOn = data & 0x01 != 0
+		m.bResetTransfer = data & 0x02 != 0
+		m.bReadMode = data & 0x04 != 0
+		m.bHorizontal = data & 0x08 != 0
+		m.bCrcControl = data & 0x10 != 0
+		m.bDiskReady = data & 0x40 != 0
+		m.bDiskIRQEnable = data & 0x80 != 0
+		m.bDiskIRQ = false
+	case 0x4026:
+		m.nExtOutput = data
+	}
+}
+
+
+func (m *Mapper020) PpuMapRead(addr uint16, mapped_addr *uint32) bool {
+	if addr < 0x2000 {
+		*mapped_addr = uint32(addr)
+		return true
+	}
+	return false
+}
+
+
+func (m *Mapper020) PpuMapWrite(addr uint16, mapped_addr *uint32) bool {
+	return m.PpuMapRead(addr, mapped_addr)
+}
+
+
+func (m *Mapper020) CpuClock() {
+	m.audio.Clock()
+
+	if m.bTimerEnable {
+		if m.nTimerCounter == 0 {
+			m.bTimerIRQ = true
+			m.nTimerCounter = m.nTimerReload
+			m.bTimerEnable = m.bTimerRepeat
+		} else {
+			m.nTimerCounter--
+		}
+	}
+
+	// the frontend can eject or swap the disk at any time, so the side is
+	// only looked at with the lock held
+	m.diskLock.Lock()
+	if m.nSwapDelay > 0 {
+		m.nSwapDelay--
+		if m.nSwapDelay == 0 {
+			m.nSide = m.nSwapSide
+		}
+	}
+	m.clockDrive()
+	m.diskLock.Unlock()
+}
+
+
+// Moves the disk under the head, one byte is transferred every
+// fdsByteCycles. With the motor off the head returns to the start and the
+// first byte arrives fdsRewindCycles after the motor comes back on.
+// Called with diskLock held
+func (m *Mapper020) clockDrive() {
+	if m.nSide != m.nHeadSide {
+		// a new side starts from the beginning, like a freshly inserted disk
+		m.nHeadSide = m.nSide
+		m.nPosition = 0
+		m.bEndOfHead = true
+		m.bScanning = false
+	}
+	if m.nSide < 0 {
+		return
+	}
+	if !m.bMotorOn {
+		m.bEndOfHead = true
+		m.bScanning = false
+		return
+	}
+	if m.bResetTransfer && !m.bScanning {
+		return
+	}
+	if m.bEndOfHead {
+		m.nDelay = fdsRewindCycles
+		m.bEndOfHead = false
+		m.nPosition = 0
+		m.bGapEnded = false
+		return
+	}
+	if m.nDelay > 0 {
+		m.nDelay--
+		return
+	}
+
+	m.bScanning = true
+
+	side := m.image.sides[m.nSide]
+	if m.bReadMode {
+		m.readByte(side[m.nPosition])
+	} else {
+		side[m.nPosition] = m.writeByte()
+		m.bDiskDirty = true
+	}
+
+	m.nPosition++
+	if m.nPosition >= len(side) {
+		m.bMotorOn = false
+	} else {
+		m.nDelay = fdsByteCycles
+	}
+}
+
+
+// The drive skips the gap until it finds a block's start mark, after that
+// every byte is handed to the CPU
+func (m *Mapper020) readByte(data uint8) {
+	if !m.bDiskReady {
+		m.bGapEnded = false
+		return
+	}
+
+	irq := m.bDiskIRQEnable
+	if data != 0 && !m.bGapEnded {
+		m.bGapEnded = true
+		irq = false  // the start mark itself doesn't interrupt
+	}
+	if m.bGapEnded {
+		m.bTransferComplete = true
+		m.nReadData = data
+		if irq {
+			m.bDiskIRQ = true
+		}
+	}
+}
+
+
+// Returns the byte to put on the disk: gap while not ready, then the CPU's
+// bytes, then the CRC the drive has been accumulating
+func (m *Mapper020) writeByte() uint8 {
+	m.bGapEnded = false
+
+	if !m.bDiskReady {
+		m.nCrc = 0
+		m.nCrcBytes = 0
+		return 0x00
+	}
+
+	if m.bCrcControl {
+		crc := fdsCrcByte(fdsCrcByte(m.nCrc, 0), 0)
+		m.nCrcBytes++
+		switch m.nCrcBytes {
+		case 1:
+			return uint8(crc)
+		case 2:
+			return uint8(crc >> 8)
+		}
+		return 0x00
+	}
+
+	m.bTransferComplete = true
+	if m.bDiskIRQEnable {
+		m.bDiskIRQ = true
+	}
+	m.nCrc = fdsCrcByte(m.nCrc, m.nWriteData)
+	return m.nWriteData
+}
+
+
+// Disk contents in the original image layout and whether they changed
+// since the last call that passed clear
+func (m *Mapper020) diskImage(clear bool) ([]uint8, bool) {
+	m.diskLock.Lock()
+	defer m.diskLock.Unlock()
+
+	dirty := m.bDiskDirty
+	if clear {
+		m.bDiskDirty = false
+	}
+	return m.image.encode(m.image.sides), dirty
+}
+
+
+// Replaces the disk contents from an image in the original layout
+func (m *Mapper020) restoreImage(data []uint8) error {
+	img, err := parseFdsImage(data)
+	if err != nil {
+		return err
+	}
+
+	m.diskLock.Lock()
+	defer m.diskLock.Unlock()
+	if len(img.sides) != len(m.image.sides) {
+		return ErrFdsBadImage
+	}
+	m.image.sides = img.sides
+	m.bDiskDirty = false
+	return nil
+}
+
+
+func (m *Mapper020) IrqPending() bool {
+	return m.bTimerIRQ || m.bDiskIRQ
+}
+
+
+func (m *Mapper020) IrqAcknowledge() {
+	m.bTimerIRQ = false
+	m.bDiskIRQ = false
+}
+
+
+func (m *Mapper020) ExpansionAudio() []ExpansionAudio {
+	return []ExpansionAudio{m.audio}
+}
+
+
+func (m *Mapper020) Mirror() int {
+	if m.bHorizontal {
+		return HORIZONTAL
+	}
+	return VERTICAL
+}
+
+
+// Resets the adapter, the disk stays in the drive
+func (m *Mapper020) Reset() {
+	m.bDiskIO = false
+	m.bSoundIO = false
+	m.nTimerReload = 0
+	m.nTimerCounter = 0
+	m.bTimerRepeat = false
+	m.bTimerEnable = false
+	m.bTimerIRQ = false
+
+	m.bMotorOn = false
+	m.bResetTransfer = false
+	m.bReadMode = true
+	m.bHorizontal = false
+	m.bCrcControl = false
+	m.bDiskReady = false
+	m.bDiskIRQEnable = false
+	m.bDiskIRQ = false
+	m.bTransferComplete = false
+	m.bEndOfHead = true
+	m.bScanning = false
+	m.bGapEnded = false
+	m.nPosition = 0
+	m.nDelay = 0
+	m.nCrc = 0
+	m.nCrcBytes = 0
+
+	m.audio.Reset()
+}
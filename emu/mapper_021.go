@@ -0,0 +1,337 @@
+package emu
+
+
+// Konami VRC2 and VRC4 boards, one implementation covers mappers 21, 22, 23
+// and 25. The boards differ in which CPU address lines feed the chip's two
+// register select pins, which is what the NES 2.0 submapper encodes
+type vrcVariant struct {
+	vrc4 bool
+	a0 uint16  // CPU address lines wired to register select bit 0
+	a1 uint16  // CPU address lines wired to register select bit 1
+	chrShift uint8  // VRC2a ignores the low bit of CHR bank numbers
+}
+
+var (
+	vrc2a = vrcVariant{vrc4: false, a0: 0x0002, a1: 0x0001, chrShift: 1}
+	vrc2b = vrcVariant{vrc4: false, a0: 0x0001, a1: 0x0002}
+	vrc2c = vrcVariant{vrc4: false, a0: 0x0002, a1: 0x0001}
+	vrc4a = vrcVariant{vrc4: true, a0: 0x0002, a1: 0x0004}
+	vrc4b = vrcVariant{vrc4: true, a0: 0x0002, a1: 0x0001}
+	vrc4c = vrcVariant{vrc4: true, a0: 0x0040, a1: 0x0080}
+	vrc4d = vrcVariant{vrc4: true, a0: 0x0008, a1: 0x0004}
+	vrc4e = vrcVariant{vrc4: true, a0: 0x0004, a1: 0x0008}
+	vrc4f = vrcVariant{vrc4: true, a0: 0x0001, a1: 0x0002}
+)
+
+
+// iNES dumps without a submapper get both wirings of the mapper number,
+// the games only ever write to one of them
+func vrcCombined(x vrcVariant, y vrcVariant) vrcVariant {
+	return vrcVariant{vrc4: true, a0: x.a0 | y.a0, a1: x.a1 | y.a1}
+}
+
+
+func init() {
+	variants := map[uint16]map[int]vrcVariant{
+		21: {ANY_SUBMAPPER: vrcCombined(vrc4a, vrc4c), 1: vrc4a, 2: vrc4c},
+		22: {ANY_SUBMAPPER: vrc2a},
+		23: {ANY_SUBMAPPER: vrcCombined(vrc4f, vrc4e), 1: vrc4f, 2: vrc4e, 3: vrc2b},
+		25: {ANY_SUBMAPPER: vrcCombined(vrc4b, vrc4d), 1: vrc4b, 2: vrc4d, 3: vrc2c},
+	}
+
+	for id, subs := range variants {
+		for sub, variant := range subs {
+			variant := variant
+			RegisterMapper(id, sub, func(info RomInfo, mem MapperMemory) (MapperInterface, error) {
+				prgBanks, chrBanks := romBanks(info)
+				mapper := NewMapper_021(prgBanks, chrBanks, variant)
+				// VRC2 boards without RAM have a one bit latch at $6000 instead
+				mapper.bLatch = !variant.vrc4 && len(mem.PrgRam) == 0
+				return mapper, nil
+			})
+		}
+	}
+}
+
+
+// VRC IRQ prescaler, counts down by 3 each CPU cycle to approximate scanlines
+const vrcPrescalerReload = 341
+
+
+// The IRQ counter shared by VRC4, VRC6 and VRC7. It counts up to $FF,
+// either every CPU cycle or once per scanline using the prescaler
+type vrcIrq struct {
+	nLatch uint8
+	nCounter uint8
+	nPrescaler int
+	bEnable bool
+	bEnableAfterAck bool
+	bCycleMode bool
+	bActive bool
+}
+
+
+func (irq *vrcIrq) writeControl(data uint8) {
+	irq.bEnableAfterAck = data & 0x01 != 0
+	irq.bEnable = data & 0x02 != 0
+	irq.bCycleMode = data & 0x04 != 0
+	if irq.bEnable {
+		irq.nCounter = irq.nLatch
+		irq.nPrescaler = vrcPrescalerReload
+	}
+	irq.bActive = false
+}
+
+
+func (irq *vrcIrq) acknowledge() {
+	irq.bActive = false
+	irq.bEnable = irq.bEnableAfterAck
+}
+
+
+func (irq *vrcIrq) clock() {
+	if !irq.bEnable {
+		return
+	}
+
+	if !irq.bCycleMode {
+		irq.nPrescaler -= 3
+		if irq.nPrescaler > 0 {
+			return
+		}
+		irq.nPrescaler += vrcPrescalerReload
+	}
+
+	if irq.nCounter == 0xFF {
+		irq.nCounter = irq.nLatch
+		irq.bActive = true
+	} else {
+		irq.nCounter++
+	}
+}
+
+
+func (irq *vrcIrq) reset() {
+	*irq = vrcIrq{nPrescaler: vrcPrescalerReload}
+}
+
+
+type Mapper021 struct {
+	Mapper
+	variant vrcVariant
+
+	nPRGBankSelect0 uint8
+	nPRGBankSelect1 uint8
+	bPRGSwapMode bool  // VRC4 only, swaps $8000 with the fixed $C000 bank
+	pCHRBankSelect [8]uint16
+	mirror int
+
+	bLatch bool  // VRC2 $6000-$6FFF latch is present
+	nLatch uint8
+
+	irq vrcIrq  // VRC4 only
+}
+
+func NewMapper_021(prgBanks uint16, chrBanks uint16, variant vrcVariant) *Mapper021 {
+	mapper := Mapper021{}
+	mapper.numPrgBanks = prgBanks
+	mapper.numChrBanks = chrBanks
+	mapper.variant = variant
+
+	return &mapper
+}
+
+
+// Translates a CPU address into the chip's $x000-$x003 register number
+func (m *Mapper021) register(addr uint16) uint16 {
+	reg := addr & 0xF000
+	if addr & m.variant.a0 != 0 {
+		reg |= 0x01
+	}
+	if addr & m.variant.a1 != 0 {
+		reg |= 0x02
+	}
+	return reg
+}
+
+
+func (m *Mapper021) CpuMapRead(addr uint16, mapped_addr *uint32, data *uint8) bool {
+	if addr >= 0x6000 && addr <= 0x6FFF && m.bLatch {
+		*data = m.nLatch
+		*mapped_addr = MAPPER_HANDLED
+		return true
+	}
+
+	if addr >= 0x8000 {
+		nPrg := uint32(m.numPrgBanks) * 2
+		var bank uint32
+
+		switch (addr >> 13) & 0x03 {
+		case 0:  // $8000
+			if m.bPRGSwapMode {
+				bank = nPrg - 2
+			} else {
+				bank = uint32(m.nPRGBankSelect0)
+			}
+		case 1:  // $A000
+			bank = uint32(m.nPRGBankSelect1)
+		case 2:  // $C000
+			if m.bPRGSwapMode {
+				bank = uint32(m.nPRGBankSelect0)
+			} else {
+				bank = nPrg - 2
+			}
+		case 3:  // $E000 always fixed to the last bank
+			bank = nPrg - 1
+		}
+
+		*mapped_addr = (bank % nPrg) * 0x2000 + uint32(addr & 0x1FFF)
+		return true
+	}
+
+	return false
+}
+
+
+func (m *Mapper021) CpuMapWrite(addr uint16, mapped_addr *uint32, data uint8) bool {
+	if addr >= 0x6000 && addr <= 0x6FFF && m.bLatch {
+		m.nLatch = data & 0x01
+		*mapped_addr = MAPPER_HANDLED
+		return true
+	}
+
+	if addr < 0x8000 {
+		return false
+	}
+
+	reg := m.register(addr)
+	switch {
+	case reg >= 0x8000 && reg <= 0x8003:
+		m.nPRGBankSelect0 = data & 0x1F
+
+	case reg == 0x9000 || reg == 0x9001:
+		m.writeMirroring(data)
+
+	case reg == 0x9002 || reg == 0x9003:
+		if m.variant.vrc4 {
+			// bit 0 is the RAM enable on some boards, games that use RAM
+			// always set it so RAM is left enabled
+			m.bPRGSwapMode = data & 0x02 != 0
+		} else {
+			m.writeMirroring(data)
+		}
+
+	case reg >= 0xA000 && reg <= 0xA003:
+		m.nPRGBankSelect1 = data & 0x1F
+
+	case reg >= 0xB000 && reg <= 0xEFFF:
+		// each 1K CHR bank is written 4 bits at a time, low then high nibble
+		bank := ((reg - 0xB000) >> 12) * 2 + (reg & 0x02) >> 1
+		if reg & 0x01 == 0 {
+			m.pCHRBankSelect[bank] = m.pCHRBankSelect[bank] & 0x1F0 | uint16(data & 0x0F)
+		} else {
+			m.pCHRBankSelect[bank] = m.pCHRBankSelect[bank] & 0x00F | uint16(data & 0x1F) << 4
+		}
+
+	case reg >= 0xF000 && m.variant.vrc4:
+		m.writeIRQ(reg, data)
+	}
+
+	// registers only, nothing gets written to PRG-ROM
+	return false
+}
+
+
+func (m *Mapper021) writeMirroring(data uint8) {
+	mode := data & 0x03
+	if !m.variant.vrc4 {
+		mode &= 0x01  // VRC2 only has vertical/horizontal
+	}
+
+	switch mode {
+	case 0:
+		m.mirror = VERTICAL
+	case 1:
+		m.mirror = HORIZONTAL
+	case 2:
+		m.mirror = ONESCREEN_LO
+	case 3:
+		m.mirror = ONESCREEN_HI
+	}
+}
+
+
+func (m *Mapper021) writeIRQ(reg uint16, data uint8) {
+	switch reg {
+	case 0xF000:  // latch, low 4 bits
+		m.irq.nLatch = m.irq.nLatch & 0xF0 | data & 0x0F
+	case 0xF001:  // latch, high 4 bits
+		m.irq.nLatch = m.irq.nLatch & 0x0F | (data & 0x0F) << 4
+	case 0xF002:
+		m.irq.writeControl(data)
+	case 0xF003:
+		m.irq.acknowledge()
+	}
+}
+
+
+func (m *Mapper021) mapChr(addr uint16) uint32 {
+	nChr := uint32(m.numChrBanks) * 8
+	if nChr == 0 {
+		nChr = 8  // 8K of CHR-RAM
+	}
+	bank := uint32(m.pCHRBankSelect[addr >> 10] >> m.variant.chrShift)
+	return (bank % nChr) * 0x0400 + uint32(addr & 0x03FF)
+}
+
+
+func (m *Mapper021) PpuMapRead(addr uint16, mapped_addr *uint32) bool {
+	if addr < 0x2000 {
+		*mapped_addr = m.mapChr(addr)
+		return true
+	}
+	return false
+}
+
+
+func (m *Mapper021) PpuMapWrite(addr uint16, mapped_addr *uint32) bool {
+	if addr < 0x2000 {
+		if m.numChrBanks == 0 {  // CHR-RAM
+			*mapped_addr = m.mapChr(addr)
+			return true
+		}
+	}
+	return false
+}
+
+
+func (m *Mapper021) CpuClock() {
+	m.irq.clock()
+}
+
+
+func (m *Mapper021) IrqPending() bool {
+	return m.irq.bActive
+}
+
+
+func (m *Mapper021) IrqAcknowledge() {
+	m.irq.bActive = false
+}
+
+
+func (m *Mapper021) Mirror() int {
+	return m.mirror
+}
+
+
+func (m *Mapper021) Reset() {
+	m.nPRGBankSelect0 = 0
+	m.nPRGBankSelect1 = 1
+	m.bPRGSwapMode = false
+	m.pCHRBankSelect = [8]uint16{}
+	m.mirror = HARDWARE
+	m.nLatch = 0
+
+	m.irq.reset()
+}
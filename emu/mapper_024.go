@@ -0,0 +1,199 @@
+package emu
+
+
+func init() {
+	RegisterMapper(24, ANY_SUBMAPPER, func(info RomInfo, mem MapperMemory) (MapperInterface, error) {
+		prgBanks, chrBanks := romBanks(info)
+		return NewMapper_024(prgBanks, chrBanks, false), nil
+	})
+	// mapper 26 boards have the register select lines swapped
+	RegisterMapper(26, ANY_SUBMAPPER, func(info RomInfo, mem MapperMemory) (MapperInterface, error) {
+		prgBanks, chrBanks := romBanks(info)
+		return NewMapper_024(prgBanks, chrBanks, true), nil
+	})
+}
+
+
+// Konami VRC6, with two pulse channels and a sawtooth of expansion audio
+type Mapper024 struct {
+	Mapper
+	audio *Vrc6Audio
+	bSwapped bool  // A0 and A1 swapped (mapper 26)
+
+	nPRGBank16 uint8  // $8000-$BFFF
+	nPRGBank8 uint8  // $C000-$DFFF
+	pCHRBank [8]uint8
+	mirror int
+	bPRGRamEnable bool
+
+	irq vrcIrq
+}
+
+func NewMapper_024(prgBanks uint16, chrBanks uint16, swapped bool) *Mapper024 {
+	mapper := Mapper024{}
+	mapper.numPrgBanks = prgBanks
+	mapper.numChrBanks = chrBanks
+	mapper.bSwapped = swapped
+	mapper.audio = NewVrc6Audio()
+
+	return &mapper
+}
+
+
+// Translates a CPU address into the chip's $x000-$x003 register number
+func (m *Mapper024) register(addr uint16) uint16 {
+	reg := addr & 0xF003
+	if m.bSwapped {
+		reg = addr & 0xF000 | (addr & 0x01) << 1 | (addr & 0x02) >> 1
+	}
+	return reg
+}
+
+
+func (m *Mapper024) CpuMapRead(addr uint16, mapped_addr *uint32, data *uint8) bool {
+	nPrg := uint32(m.numPrgBanks) * 2
+	var bank uint32
+
+	switch {
+	case addr >= 0x8000 && addr <= 0xBFFF:
+		bank = uint32(m.nPRGBank16 & 0x0F) * 2 + uint32(addr >> 13 & 0x01)
+	case addr >= 0xC000 && addr <= 0xDFFF:
+		bank = uint32(m.nPRGBank8 & 0x1F)
+	case addr >= 0xE000:
+		bank = nPrg - 1
+	default:
+		return false
+	}
+
+	*mapped_addr = (bank % nPrg) * 0x2000 + uint32(addr & 0x1FFF)
+	return true
+}
+
+
+func (m *Mapper024) CpuMapWrite(addr uint16, mapped_addr *uint32, data uint8) bool {
+	if addr < 0x8000 {
+		return false
+	}
+
+	reg := m.register(addr)
+	switch {
+	case reg >= 0x8000 && reg <= 0x8003:
+		m.nPRGBank16 = data
+	case reg >= 0x9000 && reg <= 0xB002:
+		m.audio.Write(reg, data)
+	case reg == 0xB003:
+		m.writeBankingMode(data)
+	case reg >= 0xC000 && reg <= 0xC003:
+		m.nPRGBank8 = data
+	case reg >= 0xD000 && reg <= 0xE003:
+		m.pCHRBank[(reg - 0xD000) >> 12 * 4 + reg & 0x03] = data
+	case reg == 0xF000:
+		m.irq.nLatch = data
+	case reg == 0xF001:
+		m.irq.writeControl(data)
+	case reg == 0xF002:
+		m.irq.acknowledge()
+	}
+
+	// registers only, nothing gets written to PRG-ROM
+	return false
+}
+
+
+// $B003 also selects between CHR banking modes and CHR-ROM nametables,
+// every released game uses mode 0 (eight 1K banks, mirroring in bits 2-3)
+// so only that mode is supported
+func (m *Mapper024) writeBankingMode(data uint8) {
+	switch (data >> 2) & 0x03 {
+	case 0:
+		m.mirror = VERTICAL
+	case 1:
+		m.mirror = HORIZONTAL
+	case 2:
+		m.mirror = ONESCREEN_LO
+	case 3:
+		m.mirror = ONESCREEN_HI
+	}
+	m.bPRGRamEnable = data & 0x80 != 0
+}
+
+
+func (m *Mapper024) PrgRamMapRead(addr uint16, mapped_addr *uint32) bool {
+	if !m.bPRGRamEnable {
+		return false
+	}
+	*mapped_addr = uint32(addr & 0x1FFF)
+	return true
+}
+
+
+func (m *Mapper024) PrgRamMapWrite(addr uint16, mapped_addr *uint32) bool {
+	return m.PrgRamMapRead(addr, mapped_addr)
+}
+
+
+func (m *Mapper024) mapChr(addr uint16) uint32 {
+	nChr := uint32(m.numChrBanks) * 8
+	if nChr == 0 {
+		nChr = 8  // 8K of CHR-RAM
+	}
+	return (uint32(m.pCHRBank[addr >> 10]) % nChr) * 0x0400 + uint32(addr & 0x03FF)
+}
+
+
+func (m *Mapper024) PpuMapRead(addr uint16, mapped_addr *uint32) bool {
+	if addr < 0x2000 {
+		*mapped_addr = m.mapChr(addr)
+		return true
+	}
+	return false
+}
+
+
+func (m *Mapper024) PpuMapWrite(addr uint16, mapped_addr *uint32) bool {
+	if addr < 0x2000 {
+		if m.numChrBanks == 0 {  // CHR-RAM
+			*mapped_addr = m.mapChr(addr)
+			return true
+		}
+	}
+	return false
+}
+
+
+func (m *Mapper024) CpuClock() {
+	m.audio.Clock()
+	m.irq.clock()
+}
+
+
+func (m *Mapper024) IrqPending() bool {
+	return m.irq.bActive
+}
+
+
+func (m *Mapper024) IrqAcknowledge() {
+	m.irq.bActive = false
+}
+
+
+func (m *Mapper024) ExpansionAudio() []ExpansionAudio {
+	return []ExpansionAudio{m.audio}
+}
+
+
+func (m *Mapper024) Mirror() int {
+	return m.mirror
+}
+
+
+func (m *Mapper024) Reset() {
+	m.nPRGBank16 = 0
+	m.nPRGBank8 = 0
+	m.pCHRBank = [8]uint8{}
+	m.mirror = HARDWARE
+	m.bPRGRamEnable = false
+
+	m.irq.reset()
+	m.audio.Reset()
+}
@@ -0,0 +1,114 @@
+package emu
+
+
+func init() {
+	// submapper 1 is NINA-001 and 2 is BNROM, older dumps are told apart by CHR size
+	RegisterMapper(34, ANY_SUBMAPPER, func(info RomInfo, mem MapperMemory) (MapperInterface, error) {
+		return NewMapper_034(romBanks(info)), nil
+	})
+	RegisterMapper(34, 1, func(info RomInfo, mem MapperMemory) (MapperInterface, error) {
+		mapper := NewMapper_034(romBanks(info))
+		mapper.bNINA001 = true
+		return mapper, nil
+	})
+	RegisterMapper(34, 2, func(info RomInfo, mem MapperMemory) (MapperInterface, error) {
+		mapper := NewMapper_034(romBanks(info))
+		mapper.bNINA001 = false
+		return mapper, nil
+	})
+}
+
+
+// BNROM and NINA-001 share mapper 34, NINA-001 boards are the ones with CHR-ROM
+type Mapper034 struct {
+	Mapper
+	bNINA001 bool
+	nPRGBankSelect uint8
+	nCHRBankSelectLo uint8
+	nCHRBankSelectHi uint8
+}
+
+func NewMapper_034(prgBanks uint16, chrBanks uint16) *Mapper034 {
+	mapper := Mapper034{}
+	mapper.numPrgBanks = prgBanks
+	mapper.numChrBanks = chrBanks
+	mapper.bNINA001 = chrBanks > 1
+
+	return &mapper
+}
+
+func (mapper *Mapper034) CpuMapRead(addr uint16, mapped_addr *uint32, data *uint8) bool {
+	if addr >= 0x8000 && addr <= 0xFFFF {
+		nBanks := uint32(mapper.numPrgBanks) / 2
+		if nBanks == 0 {
+			nBanks = 1
+		}
+		*mapped_addr = (uint32(mapper.nPRGBankSelect) % nBanks) * 0x8000 + uint32(addr & 0x7FFF)
+		return true
+	}
+	return false
+}
+
+
+func (mapper *Mapper034) CpuMapWrite(addr uint16, mapped_addr *uint32, data uint8) bool {
+	if mapper.bNINA001 {
+		// registers sit on top of the PRG-RAM, so writes land in both
+		switch addr {
+		case 0x7FFD:
+			mapper.nPRGBankSelect = data & 0x01
+		case 0x7FFE:
+			mapper.nCHRBankSelectLo = data & 0x0F
+		case 0x7FFF:
+			mapper.nCHRBankSelectHi = data & 0x0F
+		}
+	} else if addr >= 0x8000 && addr <= 0xFFFF {
+		mapper.nPRGBankSelect = data
+	}
+	return false
+}
+
+
+func (mapper *Mapper034) mapChr(addr uint16) uint32 {
+	if !mapper.bNINA001 {
+		return uint32(addr)
+	}
+
+	bank := uint32(mapper.nCHRBankSelectLo)
+	if addr >= 0x1000 {
+		bank = uint32(mapper.nCHRBankSelectHi)
+	}
+	return (bank % (uint32(mapper.numChrBanks) * 2)) * 0x1000 + uint32(addr & 0x0FFF)
+}
+
+
+func (mapper *Mapper034) PpuMapRead(addr uint16, mapped_addr *uint32) bool {
+	if addr < 0x2000 {
+		*mapped_addr = mapper.mapChr(addr)
+		return true
+	}
+	return false
+}
+
+
+func (mapper *Mapper034) PpuMapWrite(addr uint16, mapped_addr *uint32) bool {
+	if addr < 0x2000 {
+		if mapper.numChrBanks == 0 {
+			*mapped_addr = uint32(addr)
+			return true
+		}
+	}
+	return false
+}
+
+
+// Only the discrete BNROM board has bus conflicts
+func (mapper *Mapper034) BusConflicts() bool {
+	return !mapper.bNINA001
+}
+
+
+func (mapper *Mapper034) Reset() {
+	mapper.nPRGBankSelect = 0
+	mapper.nCHRBankSelectLo = 0
+	mapper.nCHRBankSelectHi = 0
+}
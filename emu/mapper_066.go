@@ -0,0 +1,82 @@
+package emu
+
+
+func init() {
+	RegisterMapper(66, ANY_SUBMAPPER, func(info RomInfo, mem MapperMemory) (MapperInterface, error) {
+		return NewMapper_066(romBanks(info)), nil
+	})
+}
+
+
+// GxROM, 32K PRG and 8K CHR switching from a single register
+type Mapper066 struct {
+	Mapper
+	nPRGBankSelect uint8
+	nCHRBankSelect uint8
+}
+
+func NewMapper_066(prgBanks uint16, chrBanks uint16) *Mapper066 {
+	mapper := Mapper066{}
+	mapper.numPrgBanks = prgBanks
+	mapper.numChrBanks = chrBanks
+
+	return &mapper
+}
+
+func (mapper *Mapper066) CpuMapRead(addr uint16, mapped_addr *uint32, data *uint8) bool {
+	if addr >= 0x8000 && addr <= 0xFFFF {
+		nBanks := uint32(mapper.numPrgBanks) / 2
+		if nBanks == 0 {
+			nBanks = 1
+		}
+		*mapped_addr = (uint32(mapper.nPRGBankSelect) % nBanks) * 0x8000 + uint32(addr & 0x7FFF)
+		return true
+	}
+	return false
+}
+
+
+func (mapper *Mapper066) CpuMapWrite(addr uint16, mapped_addr *uint32, data uint8) bool {
+	if addr >= 0x8000 && addr <= 0xFFFF {
+		mapper.nPRGBankSelect = (data >> 4) & 0x03
+		mapper.nCHRBankSelect = data & 0x03
+	}
+	return false
+}
+
+
+func (mapper *Mapper066) PpuMapRead(addr uint16, mapped_addr *uint32) bool {
+	if addr < 0x2000 {
+		bank := uint32(mapper.nCHRBankSelect)
+		if mapper.numChrBanks > 0 {
+			bank %= uint32(mapper.numChrBanks)
+		} else {
+			bank = 0
+		}
+		*mapped_addr = bank * 0x2000 + uint32(addr)
+		return true
+	}
+	return false
+}
+
+
+func (mapper *Mapper066) PpuMapWrite(addr uint16, mapped_addr *uint32) bool {
+	if addr < 0x2000 {
+		if mapper.numChrBanks == 0 {
+			*mapped_addr = uint32(addr)
+			return true
+		}
+	}
+	return false
+}
+
+
+func (mapper *Mapper066) BusConflicts() bool {
+	return true
+}
+
+
+func (mapper *Mapper066) Reset() {
+	mapper.nPRGBankSelect = 0
+	mapper.nCHRBankSelect = 0
+}
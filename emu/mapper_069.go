@@ -0,0 +1,209 @@
+package emu
+
+
+func init() {
+	RegisterMapper(69, ANY_SUBMAPPER, func(info RomInfo, mem MapperMemory) (MapperInterface, error) {
+		return NewMapper_069(romBanks(info)), nil
+	})
+}
+
+
+// Sunsoft FME-7 (JLROM/JSROM boards), the 5B variant adds expansion audio
+type Mapper069 struct {
+	Mapper
+	audio *Sunsoft5B
+
+	nCommand uint8
+	pCHRBank [8]uint8
+	pPRGBank [3]uint8  // $8000, $A000 and $C000
+	nPRGRamSelect uint8  // bank, RAM/ROM select and RAM enable for $6000
+	mirror int
+
+	bIRQEnable bool
+	bIRQCounterEnable bool
+	nIRQCounter uint16
+	bIRQActive bool
+}
+
+func NewMapper_069(prgBanks uint16, chrBanks uint16) *Mapper069 {
+	mapper := Mapper069{}
+	mapper.numPrgBanks = prgBanks
+	mapper.numChrBanks = chrBanks
+	mapper.audio = NewSunsoft5B()
+
+	return &mapper
+}
+
+
+func (m *Mapper069) prgBanks8K() uint32 {
+	return uint32(m.numPrgBanks) * 2
+}
+
+
+func (m *Mapper069) prgRomAt6000() bool {
+	return m.nPRGRamSelect & 0x40 == 0
+}
+
+
+func (m *Mapper069) CpuMapRead(addr uint16, mapped_addr *uint32, data *uint8) bool {
+	if addr >= 0x6000 && addr <= 0x7FFF && m.prgRomAt6000() {
+		bank := uint32(m.nPRGRamSelect & 0x3F)
+		*mapped_addr = (bank % m.prgBanks8K()) * 0x2000 + uint32(addr & 0x1FFF)
+		return true
+	}
+
+	if addr >= 0x8000 {
+		var bank uint32
+		if addr >= 0xE000 {
+			bank = m.prgBanks8K() - 1
+		} else {
+			bank = uint32(m.pPRGBank[(addr - 0x8000) >> 13] & 0x3F)
+		}
+		*mapped_addr = (bank % m.prgBanks8K()) * 0x2000 + uint32(addr & 0x1FFF)
+		return true
+	}
+
+	return false
+}
+
+
+func (m *Mapper069) CpuMapWrite(addr uint16, mapped_addr *uint32, data uint8) bool {
+	switch {
+	case addr >= 0x8000 && addr <= 0x9FFF:
+		m.nCommand = data & 0x0F
+	case addr >= 0xA000 && addr <= 0xBFFF:
+		m.writeParameter(data)
+	case addr >= 0xC000 && addr <= 0xDFFF:
+		m.audio.WriteAddress(data)
+	case addr >= 0xE000:
+		m.audio.WriteData(data)
+	}
+
+	// registers only, nothing gets written to PRG-ROM
+	return false
+}
+
+
+func (m *Mapper069) writeParameter(data uint8) {
+	switch m.nCommand {
+	case 0, 1, 2, 3, 4, 5, 6, 7:
+		m.pCHRBank[m.nCommand] = data
+	case 8:
+		m.nPRGRamSelect = data
+	case 9, 10, 11:
+		m.pPRGBank[m.nCommand - 9] = data
+	case 12:
+		switch data & 0x03 {
+		case 0:
+			m.mirror = VERTICAL
+		case 1:
+			m.mirror = HORIZONTAL
+		case 2:
+			m.mirror = ONESCREEN_LO
+		case 3:
+			m.mirror = ONESCREEN_HI
+		}
+	case 13:  // IRQ control, writing acknowledges
+		m.bIRQEnable = data & 0x01 != 0
+		m.bIRQCounterEnable = data & 0x80 != 0
+		m.bIRQActive = false
+	case 14:
+		m.nIRQCounter = m.nIRQCounter & 0xFF00 | uint16(data)
+	case 15:
+		m.nIRQCounter = m.nIRQCounter & 0x00FF | uint16(data) << 8
+	}
+}
+
+
+// RAM at $6000 needs both the RAM select and enable bits
+func (m *Mapper069) PrgRamMapRead(addr uint16, mapped_addr *uint32) bool {
+	if m.prgRomAt6000() || m.nPRGRamSelect & 0x80 == 0 {
+		return false
+	}
+	*mapped_addr = uint32(m.nPRGRamSelect & 0x3F) * 0x2000 + uint32(addr & 0x1FFF)
+	return true
+}
+
+
+func (m *Mapper069) PrgRamMapWrite(addr uint16, mapped_addr *uint32) bool {
+	return m.PrgRamMapRead(addr, mapped_addr)
+}
+
+
+func (m *Mapper069) mapChr(addr uint16) uint32 {
+	nChr := uint32(m.numChrBanks) * 8
+	if nChr == 0 {
+		nChr = 8  // 8K of CHR-RAM
+	}
+	return (uint32(m.pCHRBank[addr >> 10]) % nChr) * 0x0400 + uint32(addr & 0x03FF)
+}
+
+
+func (m *Mapper069) PpuMapRead(addr uint16, mapped_addr *uint32) bool {
+	if addr < 0x2000 {
+		*mapped_addr = m.mapChr(addr)
+		return true
+	}
+	return false
+}
+
+
+func (m *Mapper069) PpuMapWrite(addr uint16, mapped_addr *uint32) bool {
+	if addr < 0x2000 {
+		if m.numChrBanks == 0 {  // CHR-RAM
+			*mapped_addr = m.mapChr(addr)
+			return true
+		}
+	}
+	return false
+}
+
+
+// The 16 bit IRQ counter counts down every CPU cycle and fires when it wraps
+func (m *Mapper069) CpuClock() {
+	m.audio.Clock()
+
+	if !m.bIRQCounterEnable {
+		return
+	}
+	m.nIRQCounter--
+	if m.nIRQCounter == 0xFFFF && m.bIRQEnable {
+		m.bIRQActive = true
+	}
+}
+
+
+func (m *Mapper069) IrqPending() bool {
+	return m.bIRQActive
+}
+
+
+func (m *Mapper069) IrqAcknowledge() {
+	m.bIRQActive = false
+}
+
+
+func (m *Mapper069) ExpansionAudio() []ExpansionAudio {
+	return []ExpansionAudio{m.audio}
+}
+
+
+func (m *Mapper069) Mirror() int {
+	return m.mirror
+}
+
+
+func (m *Mapper069) Reset() {
+	m.nCommand = 0
+	m.pCHRBank = [8]uint8{}
+	m.pPRGBank = [3]uint8{0, 1, 2}
+	m.nPRGRamSelect = 0
+	m.mirror = HARDWARE
+
+	m.bIRQEnable = false
+	m.bIRQCounterEnable = false
+	m.nIRQCounter = 0
+	m.bIRQActive = false
+
+	m.audio.Reset()
+}
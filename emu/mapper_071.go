@@ -0,0 +1,91 @@
+package emu
+
+
+func init() {
+	RegisterMapper(71, ANY_SUBMAPPER, func(info RomInfo, mem MapperMemory) (MapperInterface, error) {
+		return NewMapper_071(romBanks(info)), nil
+	})
+}
+
+
+// Camerica BF909x, UNROM-like with optional one-screen mirroring control
+type Mapper071 struct {
+	Mapper
+	nPRGBankSelectLo uint16
+	nPRGBankSelectHi uint16
+	mirror int
+}
+
+func NewMapper_071(prgBanks uint16, chrBanks uint16) *Mapper071 {
+	mapper := Mapper071{}
+	mapper.numPrgBanks = prgBanks
+	mapper.numChrBanks = chrBanks
+
+	return &mapper
+}
+
+func (mapper *Mapper071) CpuMapRead(addr uint16, mapped_addr *uint32, data *uint8) bool {
+	if addr >= 0x8000 && addr <= 0xBFFF {
+		*mapped_addr = uint32(mapper.nPRGBankSelectLo)*0x4000 + uint32(addr&0x3FFF)
+		return true
+	}
+
+	if addr >= 0xC000 && addr <= 0xFFFF {
+		*mapped_addr = uint32(mapper.nPRGBankSelectHi)*0x4000 + uint32(addr&0x3FFF)
+		return true
+	}
+
+	return false
+}
+
+
+func (mapper *Mapper071) CpuMapWrite(addr uint16, mapped_addr *uint32, data uint8) bool {
+	if addr >= 0x9000 && addr <= 0x9FFF {  // BF9097 (Fire Hawk) mirroring control
+		if data & 0x10 != 0 {
+			mapper.mirror = ONESCREEN_HI
+		} else {
+			mapper.mirror = ONESCREEN_LO
+		}
+	} else if addr >= 0xC000 && addr <= 0xFFFF {
+		if mapper.numPrgBanks > 0 {
+			mapper.nPRGBankSelectLo = uint16(data) % mapper.numPrgBanks
+		}
+	}
+	return false
+}
+
+
+func (mapper *Mapper071) PpuMapRead(addr uint16, mapped_addr *uint32) bool {
+	if addr < 0x2000 {
+		*mapped_addr = uint32(addr)
+		return true
+	}
+	return false
+}
+
+
+func (mapper *Mapper071) PpuMapWrite(addr uint16, mapped_addr *uint32) bool {
+	if addr < 0x2000 {
+		if mapper.numChrBanks == 0 {
+			*mapped_addr = uint32(addr)
+			return true
+		}
+	}
+	return false
+}
+
+
+func (mapper *Mapper071) Mirror() int {
+	return mapper.mirror
+}
+
+
+func (mapper *Mapper071) Reset() {
+	mapper.nPRGBankSelectLo = 0
+	if mapper.numPrgBanks > 0 {
+		mapper.nPRGBankSelectHi = mapper.numPrgBanks - 1
+	} else {
+		mapper.nPRGBankSelectHi = 0
+	}
+	mapper.mirror = HARDWARE
+}
@@ -0,0 +1,77 @@
+package emu
+
+
+func init() {
+	RegisterMapper(180, ANY_SUBMAPPER, func(info RomInfo, mem MapperMemory) (MapperInterface, error) {
+		return NewMapper_180(romBanks(info)), nil
+	})
+}
+
+
+// UNROM-180 (Crazy Climber), first bank fixed with a switchable bank at $C000
+type Mapper180 struct {
+	Mapper
+	nPRGBankSelectHi uint16
+}
+
+func NewMapper_180(prgBanks uint16, chrBanks uint16) *Mapper180 {
+	mapper := Mapper180{}
+	mapper.numPrgBanks = prgBanks
+	mapper.numChrBanks = chrBanks
+
+	return &mapper
+}
+
+func (mapper *Mapper180) CpuMapRead(addr uint16, mapped_addr *uint32, data *uint8) bool {
+	if addr >= 0x8000 && addr <= 0xBFFF {
+		*mapped_addr = uint32(addr & 0x3FFF)
+		return true
+	}
+
+	if addr >= 0xC000 && addr <= 0xFFFF {
+		*mapped_addr = uint32(mapper.nPRGBankSelectHi)*0x4000 + uint32(addr&0x3FFF)
+		return true
+	}
+
+	return false
+}
+
+
+func (mapper *Mapper180) CpuMapWrite(addr uint16, mapped_addr *uint32, data uint8) bool {
+	if addr >= 0x8000 && addr <= 0xFFFF {
+		if mapper.numPrgBanks > 0 {
+			mapper.nPRGBankSelectHi = uint16(data & 0x07) % mapper.numPrgBanks
+		}
+	}
+	return false
+}
+
+
+func (mapper *Mapper180) PpuMapRead(addr uint16, mapped_addr *uint32) bool {
+	if addr < 0x2000 {
+		*mapped_addr = uint32(addr)
+		return true
+	}
+	return false
+}
+
+
+func (mapper *Mapper180) PpuMapWrite(addr uint16, mapped_addr *uint32) bool {
+	if addr < 0x2000 {
+		if mapper.numChrBanks == 0 {
+			*mapped_addr = uint32(addr)
+			return true
+		}
+	}
+	return false
+}
+
+
+func (mapper *Mapper180) BusConflicts() bool {
+	return true
+}
+
+
+func (mapper *Mapper180) Reset() {
+	mapper.nPRGBankSelectHi = 0
+}
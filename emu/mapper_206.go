@@ -0,0 +1,37 @@
+package emu
+
+
+func init() {
+	RegisterMapper(206, ANY_SUBMAPPER, func(info RomInfo, mem MapperMemory) (MapperInterface, error) {
+		return NewMapper_206(romBanks(info)), nil
+	})
+}
+
+
+// Namco 108 (DxROM boards, e.g. Gauntlet with four-screen VRAM), the chip
+// MMC3 grew out of: only the bank registers, no PRG/CHR mode bits,
+// mirroring control or IRQ
+type Mapper206 struct {
+	Mapper004
+}
+
+func NewMapper_206(prgBanks uint16, chrBanks uint16) *Mapper206 {
+	mapper := Mapper206{}
+	mapper.numPrgBanks = prgBanks
+	mapper.numChrBanks = chrBanks
+
+	return &mapper
+}
+
+
+func (m *Mapper206) CpuMapWrite(addr uint16, mapped_addr *uint32, data uint8) bool {
+	if addr >= 0x8000 && addr <= 0x9FFF {
+		if addr & 0x0001 == 0 {
+			data &= 0x07  // the mode bits don't exist
+		} else {
+			data &= 0x3F
+		}
+		m.Mapper004.CpuMapWrite(addr, mapped_addr, data)
+	}
+	return false
+}
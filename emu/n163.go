@@ -0,0 +1,141 @@
+package emu
+
+
+// Namco 163 sound: up to eight wavetable channels playing 4 bit samples out
+// of 128 bytes of internal RAM, which also holds the channel registers.
+// The chip updates one channel every 15 CPU cycles and switches its output
+// between the channels, so enabling more channels lowers the sample rate
+type N163Audio struct {
+	ram [128]uint8
+	nAddress uint8
+	bAutoIncrement bool
+	bDisable bool  // set through the mapper's $E000 register
+
+	nCycle uint8  // CPU cycles until the next channel update
+	nChannel uint8  // channel updated next, counts down from 7
+	pOutput [8]int  // last output of each channel, -120 to 105
+}
+
+
+func NewN163Audio() *N163Audio {
+	chip := N163Audio{}
+	chip.Reset()
+	return &chip
+}
+
+
+// $F800-$FFFF sets the RAM address for the data port
+func (n *N163Audio) WriteAddress(data uint8) {
+	n.nAddress = data & 0x7F
+	n.bAutoIncrement = data & 0x80 != 0
+}
+
+
+// $4800-$4FFF reads and writes RAM at the current address
+func (n *N163Audio) ReadData() uint8 {
+	data := n.ram[n.nAddress]
+	n.advance()
+	return data
+}
+
+
+func (n *N163Audio) WriteData(data uint8) {
+	n.ram[n.nAddress] = data
+	n.advance()
+}
+
+
+func (n *N163Audio) advance() {
+	if n.bAutoIncrement {
+		n.nAddress = (n.nAddress + 1) & 0x7F
+	}
+}
+
+
+// The last channel register byte at $7F also holds the channel count
+func (n *N163Audio) activeChannels() uint8 {
+	return (n.ram[0x7F] >> 4) & 0x07 + 1
+}
+
+
+// Advances the chip by one CPU cycle
+func (n *N163Audio) Clock() {
+	if n.bDisable {
+		return
+	}
+
+	n.nCycle++
+	if n.nCycle < 15 {
+		return
+	}
+	n.nCycle = 0
+
+	n.updateChannel(n.nChannel)
+
+	if n.nChannel <= 8 - n.activeChannels() {
+		n.nChannel = 7
+	} else {
+		n.nChannel--
+	}
+}
+
+
+// Channel registers for channel c start at $40 + c * 8: frequency (18 bits,
+// spread over bytes 0, 2 and 4), phase (24 bits in bytes 1, 3 and 5),
+// wave length in the top 6 bits of byte 4, wave address and volume
+func (n *N163Audio) updateChannel(c uint8) {
+	base := 0x40 + int(c) * 8
+	regs := n.ram[base:base + 8]
+
+	freq := uint32(regs[0]) | uint32(regs[2]) << 8 | uint32(regs[4] & 0x03) << 16
+	phase := uint32(regs[1]) | uint32(regs[3]) << 8 | uint32(regs[5]) << 16
+	length := (256 - uint32(regs[4] & 0xFC)) << 16
+
+	phase = (phase + freq) % length
+	regs[1] = uint8(phase)
+	regs[3] = uint8(phase >> 8)
+	regs[5] = uint8(phase >> 16)
+
+	// samples are packed two to a byte, low nibble first
+	index := uint8(phase >> 16) + regs[6]
+	sample := n.ram[index >> 1] >> ((index & 0x01) * 4) & 0x0F
+
+	n.pOutput[c] = (int(sample) - 8) * int(regs[7] & 0x0F)
+}
+
+
+// Returns the average of the active channels, from -1 to 1
+func (n *N163Audio) Output() float32 {
+	if n.bDisable {
+		return 0
+	}
+
+	active := n.activeChannels()
+	out := 0
+	for c := 8 - active; c < 8; c++ {
+		out += n.pOutput[c]
+	}
+	return float32(out) / float32(active) / 120
+}
+
+
+// Varies a lot between boards, this is around the middle
+func (n *N163Audio) Level() float32 {
+	return 0.35
+}
+
+
+func (n *N163Audio) Name() string {
+	return "n163"
+}
+
+
+func (n *N163Audio) Reset() {
+	n.ram = [128]uint8{}
+	n.nAddress = 0
+	n.bAutoIncrement = false
+	n.bDisable = false
+	n.nCycle = 0
+	n.nChannel = 7
+	n.pOutput = [8]int{}
+}
@@ -0,0 +1,238 @@
+package emu
+
+import (
+	"sync"
+	"time"
+)
+
+
+// NTSC frame rate, a frame is 341 * 262 - 0.5 PPU cycles (odd frames skip one)
+const NTSC_FRAME_RATE = CPU_CLOCK_RATE * 3 / (341 * 262 - 0.5)
+
+// How frames get paced
+const (
+	PACE_WALL_CLOCK = iota  // frames run on a timer at the NTSC rate
+	PACE_VSYNC  // the frontend calls Vsync on every display refresh
+	PACE_AUDIO  // frames run whenever the audio buffer needs filling
+)
+
+const (
+	pacerMaxLag = 10  // frames behind before giving up on catching up
+	pacerAudioLatency = 3  // frames of audio to keep buffered
+	pacerMaxRateAdjust = 0.005  // most the sample rate is bent to track the audio buffer
+	pacerIdleSleep = time.Millisecond
+)
+
+
+type PacerStats struct {
+	Frames uint64  // frames emulated
+	Presented uint64  // frames handed to the frontend
+	Dropped uint64  // frames emulated to catch up but never shown
+	Duplicated uint64  // display refreshes that had no new frame and repeated the last, see Refreshed
+}
+
+
+// Runs the bus at the NTSC frame rate. With wall clock or vsync pacing the
+// emulator's clock can drift from the audio device's, so the resampler's
+// rate is nudged to keep the audio buffer near its target (dynamic rate
+// control). With audio pacing the audio device is the clock
+type Pacer struct {
+	bus *Bus
+	mode int
+	frameTime time.Duration
+
+	lastVsync time.Time
+	fPending float64  // frames owed to the display, for vsync pacing
+
+	lock sync.Mutex  // guards stats and nRefreshPresented
+	stats PacerStats
+	nRefreshPresented uint64  // stats.Presented at the last display refresh
+
+	stop chan struct{}
+	done chan struct{}  // closed when the pacing goroutine exits
+}
+
+
+func NewPacer(bus *Bus, mode int) *Pacer {
+	pacer := Pacer{}
+	pacer.bus = bus
+	pacer.mode = mode
+	rate := NTSC_FRAME_RATE
+	pacer.frameTime = time.Duration(float64(time.Second) / rate)
+	return &pacer
+}
+
+
+func (p *Pacer) Mode() int {
+	return p.mode
+}
+
+
+func (p *Pacer) Stats() PacerStats {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.stats
+}
+
+
+// Runs one frame, present is only called if the frame is to be shown
+func (p *Pacer) runFrame(present func(), show bool) {
+	p.bus.RunFrame()
+
+	p.lock.Lock()
+	p.stats.Frames++
+	if show {
+		p.stats.Presented++
+	} else {
+		p.stats.Dropped++
+	}
+	p.lock.Unlock()
+
+	if show && present != nil {
+		present()
+	}
+}
+
+
+// Samples kept in the audio buffer between frames
+func (p *Pacer) audioTarget() int {
+	return int(p.bus.SampleRate() * pacerAudioLatency / NTSC_FRAME_RATE)
+}
+
+
+// Bends the resampling rate towards keeping the audio buffer at its target,
+// too full and samples are produced slower, too empty and faster
+func (p *Pacer) controlRate() {
+	r := p.bus.resampler
+	if r == nil {
+		return
+	}
+	target := float64(p.audioTarget())
+	adjust := (target - float64(r.Available())) / target * pacerMaxRateAdjust
+	if adjust > pacerMaxRateAdjust {
+		adjust = pacerMaxRateAdjust
+	} else if adjust < -pacerMaxRateAdjust {
+		adjust = -pacerMaxRateAdjust
+	}
+	r.SetRateAdjust(1 + adjust)
+}
+
+
+// Starts pacing frames on a goroutine, for PACE_WALL_CLOCK and PACE_AUDIO.
+// present is called after each frame that should be shown. Audio pacing
+// falls back to the wall clock if the bus has no sample rate set
+func (p *Pacer) Start(present func()) {
+	p.Stop()
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	p.stop = stop
+	p.done = done
+
+	go func() {
+		defer close(done)
+		if p.mode == PACE_AUDIO && p.bus.SampleRate() > 0 {
+			p.runAudio(present, stop)
+		} else {
+			p.runWallClock(present, stop)
+		}
+	}()
+}
+
+
+// Stops pacing, waiting for the frame in progress to finish
+func (p *Pacer) Stop() {
+	if p.stop != nil {
+		close(p.stop)
+		<-p.done
+		p.stop = nil
+		p.done = nil
+	}
+}
+
+
+func (p *Pacer) runWallClock(present func(), stop chan struct{}) {
+	deadline := time.Now()
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		deadline = deadline.Add(p.frameTime)
+		now := time.Now()
+		if wait := deadline.Sub(now); wait > 0 {
+			time.Sleep(wait)
+		} else if -wait > p.frameTime * pacerMaxLag {
+			deadline = now  // too far behind, e.g. the process was suspended
+		}
+
+		// only show the frame if the next one isn't already due
+		p.runFrame(present, time.Until(deadline) > -p.frameTime)
+		p.controlRate()
+	}
+}
+
+
+func (p *Pacer) runAudio(present func(), stop chan struct{}) {
+	target := p.audioTarget()
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		available := p.bus.SamplesAvailable()
+		if available >= target {
+			time.Sleep(pacerIdleSleep)
+			continue
+		}
+
+		// when less than a frame's worth is left there's no time to show it
+		p.runFrame(present, available > target / pacerAudioLatency)
+	}
+}
+
+
+// For PACE_VSYNC, called by the frontend once per display refresh. Runs as
+// many frames as the time since the last refresh is worth, so a display
+// slower than the NES drops frames and a faster one repeats them
+func (p *Pacer) Vsync(present func()) {
+	now := time.Now()
+	if p.lastVsync.IsZero() {
+		p.lastVsync = now
+		p.fPending = 1
+	}
+	p.fPending += float64(now.Sub(p.lastVsync)) / float64(p.frameTime)
+	p.lastVsync = now
+	if p.fPending > pacerMaxLag {
+		p.fPending = 1
+	}
+
+	if p.fPending < 1 {
+		p.Refreshed()
+		return
+	}
+
+	for p.fPending >= 1 {
+		p.fPending--
+		p.runFrame(present, p.fPending < 1)  // only the newest frame is shown
+	}
+	p.controlRate()
+	p.Refreshed()
+}
+
+
+// Called by the frontend on every display refresh, counts the refreshes
+// that repeat the last frame because no new one was presented since the
+// previous refresh. Vsync calls this itself
+func (p *Pacer) Refreshed() {
+	p.lock.Lock()
+	if p.stats.Presented == p.nRefreshPresented {
+		p.stats.Duplicated++
+	}
+	p.nRefreshPresented = p.stats.Presented
+	p.lock.Unlock()
+}
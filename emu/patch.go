@@ -0,0 +1,369 @@
+package emu
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+
+// extensions searched for next to a ROM, in order of preference
+var patchExtensions = []string{".bps", ".ups", ".ips"}
+
+
+var ErrUnknownPatch = errors.New("unrecognised patch format")
+var ErrPatchCorrupt = errors.New("patch data is corrupt")
+
+
+// Returned when a UPS/BPS checksum doesn't match
+type ErrPatchChecksum struct {
+	Which string  // "source", "target" or "patch"
+	Want uint32
+	Got uint32
+}
+
+func (e *ErrPatchChecksum) Error() string {
+	return fmt.Sprintf("%s checksum mismatch: expected %08X, got %08X", e.Which, e.Want, e.Got)
+}
+
+
+// Applies an IPS, UPS or BPS patch to a ROM image, the format is picked from
+// the patch header and rom is left untouched
+func ApplyPatch(rom []byte, patch []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(patch, []byte("PATCH")):
+		return applyIPS(rom, patch)
+	case bytes.HasPrefix(patch, []byte("UPS1")):
+		return applyUPS(rom, patch)
+	case bytes.HasPrefix(patch, []byte("BPS1")):
+		return applyBPS(rom, patch)
+	}
+	return nil, ErrUnknownPatch
+}
+
+
+// Looks for a patch with the same base name as the ROM, returns "" if there is none
+func findPatchFor(romPath string) string {
+	base := strings.TrimSuffix(romPath, filepath.Ext(romPath))
+	for _, ext := range patchExtensions {
+		for _, candidate := range []string{base + ext, base + strings.ToUpper(ext)} {
+			if _, err := os.Stat(candidate); err == nil {
+				return candidate
+			}
+		}
+	}
+	return ""
+}
+
+
+func applyPatchFile(rom []byte, patchPath string) ([]byte, error) {
+	patch, err := ioutil.ReadFile(patchPath)
+	if err != nil {
+		return nil, err
+	}
+	patched, err := ApplyPatch(rom, patch)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", patchPath, err)
+	}
+	return patched, nil
+}
+
+
+// IPS: a list of (offset, data) records, with run length encoded fills
+func applyIPS(rom []byte, patch []byte) ([]byte, error) {
+	out := make([]byte, len(rom))
+	copy(out, rom)
+
+	// grows the output so a record can be written past the end of the ROM
+	ensure := func(size int) {
+		if size > len(out) {
+			grown := make([]byte, size)
+			copy(grown, out)
+			out = grown
+		}
+	}
+
+	p := 5
+	for {
+		if p + 3 > len(patch) {
+			return nil, ErrPatchCorrupt
+		}
+		if string(patch[p:p+3]) == "EOF" {
+			p += 3
+			break
+		}
+
+		offset := int(patch[p]) << 16 | int(patch[p+1]) << 8 | int(patch[p+2])
+		p += 3
+		if p + 2 > len(patch) {
+			return nil, ErrPatchCorrupt
+		}
+		size := int(binary.BigEndian.Uint16(patch[p:]))
+		p += 2
+
+		if size == 0 {  // RLE record
+			if p + 3 > len(patch) {
+				return nil, ErrPatchCorrupt
+			}
+			count := int(binary.BigEndian.Uint16(patch[p:]))
+			value := patch[p+2]
+			p += 3
+
+			ensure(offset + count)
+			for i := 0; i < count; i++ {
+				out[offset+i] = value
+			}
+		} else {
+			if p + size > len(patch) {
+				return nil, ErrPatchCorrupt
+			}
+			ensure(offset + size)
+			copy(out[offset:], patch[p:p+size])
+			p += size
+		}
+	}
+
+	// optional truncation extension
+	if p + 3 <= len(patch) {
+		size := int(patch[p]) << 16 | int(patch[p+1]) << 8 | int(patch[p+2])
+		if size < len(out) {
+			out = out[:size]
+		}
+	}
+
+	return out, nil
+}
+
+
+// Builds an IPS patch turning rom into modified, both must be the same size
+func createIPS(rom []byte, modified []byte) []byte {
+	patch := []byte("PATCH")
+
+	for i := 0; i < len(modified); {
+		if modified[i] == rom[i] {
+			i++
+			continue
+		}
+
+		// an offset of $454F46 would read as the "EOF" marker
+		start := i
+		if start == 0x454F46 {
+			start--
+		}
+		end := i
+		for end < len(modified) && end - start < 0xFFFF && modified[end] != rom[end] {
+			end++
+		}
+
+		patch = append(patch, uint8(start >> 16), uint8(start >> 8), uint8(start))
+		patch = append(patch, uint8((end - start) >> 8), uint8(end - start))
+		patch = append(patch, modified[start:end]...)
+		i = end
+	}
+
+	return append(patch, "EOF"...)
+}
+
+
+// Reads the variable length integers used by UPS and BPS
+func decodePatchNumber(patch []byte, p *int, end int) (uint64, error) {
+	data := uint64(0)
+	shift := uint64(1)
+	for {
+		if *p >= end {
+			return 0, ErrPatchCorrupt
+		}
+		x := patch[*p]
+		*p++
+		data += uint64(x & 0x7F) * shift
+		if x & 0x80 != 0 {
+			break
+		}
+		shift <<= 7
+		data += shift
+		if shift > 1 << 56 {
+			return 0, ErrPatchCorrupt
+		}
+	}
+	return data, nil
+}
+
+
+// Validates the 12 byte source/target/patch CRC32 footer shared by UPS and BPS
+func checkPatchFooter(rom []byte, patch []byte) (uint32, error) {
+	if len(patch) < 16 {
+		return 0, ErrPatchCorrupt
+	}
+	footer := patch[len(patch)-12:]
+	sourceCRC := binary.LittleEndian.Uint32(footer[0:])
+	targetCRC := binary.LittleEndian.Uint32(footer[4:])
+	patchCRC := binary.LittleEndian.Uint32(footer[8:])
+
+	if got := crc32.ChecksumIEEE(patch[:len(patch)-4]); got != patchCRC {
+		return 0, &ErrPatchChecksum{"patch", patchCRC, got}
+	}
+	if got := crc32.ChecksumIEEE(rom); got != sourceCRC {
+		return 0, &ErrPatchChecksum{"source", sourceCRC, got}
+	}
+	return targetCRC, nil
+}
+
+
+// UPS: XOR hunks at relative offsets
+func applyUPS(rom []byte, patch []byte) ([]byte, error) {
+	targetCRC, err := checkPatchFooter(rom, patch)
+	if err != nil {
+		return nil, err
+	}
+
+	end := len(patch) - 12
+	p := 4
+	sourceSize, err := decodePatchNumber(patch, &p, end)
+	if err != nil {
+		return nil, err
+	}
+	targetSize, err := decodePatchNumber(patch, &p, end)
+	if err != nil {
+		return nil, err
+	}
+	if sourceSize != uint64(len(rom)) || targetSize > maxArchiveMemberSize {
+		return nil, ErrPatchCorrupt
+	}
+
+	out := make([]byte, targetSize)
+	copy(out, rom)
+
+	offset := uint64(0)
+	for p < end {
+		relative, err := decodePatchNumber(patch, &p, end)
+		if err != nil {
+			return nil, err
+		}
+		offset += relative
+
+		for {
+			if p >= end {
+				return nil, ErrPatchCorrupt
+			}
+			x := patch[p]
+			p++
+			if offset < targetSize {
+				out[offset] ^= x
+			}
+			offset++
+			if x == 0 {
+				break
+			}
+		}
+	}
+
+	if got := crc32.ChecksumIEEE(out); got != targetCRC {
+		return nil, &ErrPatchChecksum{"target", targetCRC, got}
+	}
+	return out, nil
+}
+
+
+// BPS: a stream of copy commands from the source, patch or target itself
+func applyBPS(rom []byte, patch []byte) ([]byte, error) {
+	targetCRC, err := checkPatchFooter(rom, patch)
+	if err != nil {
+		return nil, err
+	}
+
+	end := len(patch) - 12
+	p := 4
+	sourceSize, err := decodePatchNumber(patch, &p, end)
+	if err != nil {
+		return nil, err
+	}
+	targetSize, err := decodePatchNumber(patch, &p, end)
+	if err != nil {
+		return nil, err
+	}
+	metadataSize, err := decodePatchNumber(patch, &p, end)
+	if err != nil {
+		return nil, err
+	}
+	if sourceSize != uint64(len(rom)) || targetSize > maxArchiveMemberSize ||
+		metadataSize > uint64(end - p) {
+		return nil, ErrPatchCorrupt
+	}
+	p += int(metadataSize)
+
+	out := make([]byte, targetSize)
+	outputOffset := uint64(0)
+	sourceRelative := int64(0)
+	targetRelative := int64(0)
+
+	for p < end {
+		data, err := decodePatchNumber(patch, &p, end)
+		if err != nil {
+			return nil, err
+		}
+		command := data & 0x03
+		length := (data >> 2) + 1
+		if outputOffset + length > targetSize {
+			return nil, ErrPatchCorrupt
+		}
+
+		switch command {
+		case 0:  // SourceRead
+			if outputOffset + length > sourceSize {
+				return nil, ErrPatchCorrupt
+			}
+			copy(out[outputOffset:outputOffset+length], rom[outputOffset:])
+			outputOffset += length
+
+		case 1:  // TargetRead
+			if uint64(p) + length > uint64(end) {
+				return nil, ErrPatchCorrupt
+			}
+			copy(out[outputOffset:], patch[p:p+int(length)])
+			p += int(length)
+			outputOffset += length
+
+		case 2, 3:  // SourceCopy, TargetCopy
+			data, err := decodePatchNumber(patch, &p, end)
+			if err != nil {
+				return nil, err
+			}
+			delta := int64(data >> 1)
+			if data & 0x01 != 0 {
+				delta = -delta
+			}
+
+			if command == 2 {
+				sourceRelative += delta
+				if sourceRelative < 0 || uint64(sourceRelative) + length > sourceSize {
+					return nil, ErrPatchCorrupt
+				}
+				copy(out[outputOffset:outputOffset+length], rom[sourceRelative:])
+				sourceRelative += int64(length)
+				outputOffset += length
+			} else {
+				targetRelative += delta
+				if targetRelative < 0 || uint64(targetRelative) >= outputOffset {
+					return nil, ErrPatchCorrupt
+				}
+				// byte by byte as the copy may overlap the bytes it produces
+				for i := uint64(0); i < length; i++ {
+					out[outputOffset] = out[targetRelative]
+					outputOffset++
+					targetRelative++
+				}
+			}
+		}
+	}
+
+	if got := crc32.ChecksumIEEE(out); got != targetCRC {
+		return nil, &ErrPatchChecksum{"target", targetCRC, got}
+	}
+	return out, nil
+}
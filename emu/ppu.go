@@ -142,14 +142,15 @@ func (p *PPU) GetOAMEntry(index int) sObjectAttributeEntry {
 
 
 type PPU struct {
-	cart Cartridge
+	cart *Cartridge
 
-	nameTable [2][1024]uint8
+	nameTable [2][1024]uint8  // CIRAM, the cartridge decides how it is mapped
 	patternTable[2][4096]uint8
 	paletteTable [32]uint8
 
 	scanline int16
 	cycle int16
+	clockCount uint64  // total PPU cycles, used by mappers to time bus activity
 	
 	FrameComplete bool
 
@@ -344,6 +345,7 @@ func (p *PPU) CpuRead(addr uint16, bReadOnly bool) uint8 {
 			break
 		case 0x0007:  // PPU data
 			data = p.ppuDataBuffer
+			p.busAddress(p.vramAddr.GetRegisters())
 			p.ppuDataBuffer = p.PpuRead(p.vramAddr.GetRegisters(), true)
 
 			if p.vramAddr.GetRegisters() > 0x3f00 {
@@ -398,10 +400,12 @@ func (p *PPU) CpuWrite(addr uint16, data uint8) {
 			} else {
 				p.tramAddr.SetRegisters((p.tramAddr.GetRegisters() & 0xFF00) | uint16(data))
 				*p.vramAddr = *p.tramAddr
+				p.busAddress(p.vramAddr.GetRegisters())
 				p.addressLatch = 0
 			}
 			break
 		case 0x0007:  // PPU data
+			p.busAddress(p.vramAddr.GetRegisters())
 			p.PpuWrite(p.vramAddr.GetRegisters(), data)
 			
 			if p.control.incrementMode {
@@ -415,27 +419,31 @@ func (p *PPU) CpuWrite(addr uint16, data uint8) {
 
 
 func (p *PPU) PpuRead(addr uint16, bReadOnly bool) uint8 {
+	return p.read(addr, PPU_FETCH_CPU)
+}
+
+
+// Reads memory for rendering, telling the cartridge what the fetch is for
+func (p *PPU) fetch(addr uint16, kind int) uint8 {
+	if !p.renderingEnabled() {
+		kind = PPU_FETCH_CPU
+	}
+	return p.read(addr, kind)
+}
+
+
+func (p *PPU) read(addr uint16, kind int) uint8 {
 	data := uint8(0x00)
 	addr &= 0x3FFF
 
-	if p.cart.PpuRead(addr, &data) {
+	if addr < 0x3F00 && p.cart.PpuFetch(addr, kind, &data) {
+		// mapper supplied the data
+	} else if p.cart.PpuRead(addr, &data) {
 		// cartridge address range
 	} else if addr >= 0x0000 && addr <= 0x1FFF {  // pattern table
 		data = p.patternTable[(addr & 0x1000) >> 12][addr & 0x0FFF]
 	} else if addr >= 0x2000 && addr <= 0x3EFF {  // nametable
-		addr &= 0x0FFF
-
-		if p.cart.mirror == VERTICAL {
-			if addr >= 0x0000 && addr <= 0x03FF {data = p.nameTable[0][addr & 0x03FF]}
-			if addr >= 0x0400 && addr <= 0x07FF {data = p.nameTable[1][addr & 0x03FF]}
-			if addr >= 0x0800 && addr <= 0x0BFF {data = p.nameTable[0][addr & 0x03FF]}
-			if addr >= 0x0C00 && addr <= 0x0FFF {data = p.nameTable[1][addr & 0x03FF]}
-		} else if p.cart.mirror == HORIZONTAL {
-			if addr >= 0x0000 && addr <= 0x03FF {data = p.nameTable[0][addr & 0x03FF]}
-			if addr >= 0x0400 && addr <= 0x07FF {data = p.nameTable[0][addr & 0x03FF]}
-			if addr >= 0x0800 && addr <= 0x0BFF {data = p.nameTable[1][addr & 0x03FF]}
-			if addr >= 0x0C00 && addr <= 0x0FFF {data = p.nameTable[1][addr & 0x03FF]}
-		}
+		data = p.cart.NametableRead(addr & 0x2FFF, &p.nameTable)
 	} else if addr >= 0x3F00 && addr <= 0x3FFF { // palette memory
 		addr &= 0x001F
 
@@ -458,24 +466,14 @@ func (p *PPU) PpuRead(addr uint16, bReadOnly bool) uint8 {
 func (p *PPU) PpuWrite(addr uint16, data uint8) {
 	addr &= 0x3FFF
 
-	if p.cart.PpuWrite(addr, data) {
+	if addr < 0x3F00 && p.cart.PpuStore(addr, data) {
+		// mapper took the data
+	} else if p.cart.PpuWrite(addr, data) {
 		// cartridge address range
 	} else if addr >= 0x0000 && addr <= 0x1FFF { // pattern table
 		p.patternTable[(addr & 0x1000) >> 12][addr & 0x0FFF] = data
 	} else if addr >= 0x2000 && addr <= 0x3EFF { // nametable
-		addr &= 0x0FFF
-
-		if p.cart.mirror == VERTICAL {
-			if addr >= 0x0000 && addr <= 0x03FF {p.nameTable[0][addr & 0x03FF] = data}
-			if addr >= 0x0400 && addr <= 0x07FF {p.nameTable[1][addr & 0x03FF] = data}
-			if addr >= 0x0800 && addr <= 0x0BFF {p.nameTable[0][addr & 0x03FF] = data}
-			if addr >= 0x0C00 && addr <= 0x0FFF {p.nameTable[1][addr & 0x03FF] = data}
-		} else if p.cart.mirror == HORIZONTAL {
-			if addr >= 0x0000 && addr <= 0x03FF {p.nameTable[0][addr & 0x03FF] = data}
-			if addr >= 0x0400 && addr <= 0x07FF {p.nameTable[0][addr & 0x03FF] = data}
-			if addr >= 0x0800 && addr <= 0x0BFF {p.nameTable[1][addr & 0x03FF] = data}
-			if addr >= 0x0C00 && addr <= 0x0FFF {p.nameTable[1][addr & 0x03FF] = data}
-		}
+		p.cart.NametableWrite(addr & 0x2FFF, &p.nameTable, data)
 	} else if addr >= 0x3F00 && addr <= 0x3FFF { // palette memory
 		addr &= 0x001F
 
@@ -488,8 +486,59 @@ func (p *PPU) PpuWrite(addr uint16, data uint8) {
 }
 
 
+// Lets the cartridge observe addresses the PPU puts on its bus
+// palette accesses stay internal to the PPU so are not reported
+func (p *PPU) busAddress(addr uint16) {
+	addr &= 0x3FFF
+	if addr < 0x3F00 {
+		p.cart.PpuBusAddress(addr, p.clockCount)
+	}
+}
+
+
+// Pattern address of the low plane for a sprite slot on the current line,
+// unused slots (and every slot on the pre-render line) fetch tile $FF, which
+// is what clocks A12 based scanline counters on lines without any sprites
+func (p *PPU) spritePatternAddr(slot int) uint16 {
+	if p.scanline < 0 || slot >= int(p.spriteCount) {
+		if p.control.spriteSize {
+			return 0x1FF0
+		}
+		return Btoi16(p.control.patternSprite)<<12 | 0x0FF0
+	}
+
+	e := p.spriteScanLine[slot]
+	row := int16(p.scanline) - int16(e.y)
+
+	if e.attribute&0x80 != 0 { // vertical flip
+		row ^= 0x07
+		if p.control.spriteSize && row >= 8 {
+			row ^= 0x07
+		}
+	}
+
+	if !p.control.spriteSize { // 8×8
+		return Btoi16(p.control.patternSprite)<<12 |
+			uint16(e.id)<<4 | uint16(row&0x07)
+	}
+
+	// 8×16
+	tile := e.id & 0xFE
+	if row >= 8 {
+		tile++
+	}
+	table := e.id & 0x01
+	return uint16(table)<<12 | uint16(tile)<<4 | uint16(row&0x07)
+}
+
+
+func (p *PPU) renderingEnabled() bool {
+	return p.mask.renderBackground || p.mask.renderSprites
+}
+
+
 func (p *PPU) ConnectCartridge(cartridge *Cartridge) {
-	p.cart = *cartridge
+	p.cart = cartridge
 }
 
 
@@ -632,7 +681,7 @@ func (p *PPU) Clock() {
 			switch (p.cycle - 1) % 8 {
 			case 0:
 				loadBackgroundShifters()
-				p.bgNextTileID = p.PpuRead(0x2000|(p.vramAddr.GetRegisters()&0x0FFF), true)
+				p.bgNextTileID = p.fetch(0x2000|(p.vramAddr.GetRegisters()&0x0FFF), PPU_FETCH_NAMETABLE)
 
 			case 2:
 				attrAddr := uint16(0x23C0 |
@@ -640,18 +689,22 @@ func (p *PPU) Clock() {
 					(Btoi16(p.vramAddr.nametableX) << 10) |
 					((p.vramAddr.coarseY >> 2) << 3) |
 					(p.vramAddr.coarseX >> 2))
-				attr := p.PpuRead(attrAddr, true)
+				attr := p.fetch(attrAddr, PPU_FETCH_ATTRIBUTE)
 				if p.vramAddr.coarseY&0x02 != 0 { attr >>= 4 }
 				if p.vramAddr.coarseX&0x02 != 0 { attr >>= 2 }
 				p.bgNextTileAttrib = attr & 0x03
 
 			case 4:
 				base := p.BackgroundPatternTableBase()
-				p.bgNextTileLsb = p.PpuRead(base+uint16(p.bgNextTileID)*16+uint16(p.vramAddr.fineY), true)
+				addr := base+uint16(p.bgNextTileID)*16+uint16(p.vramAddr.fineY)
+				if p.renderingEnabled() { p.busAddress(addr) }
+				p.bgNextTileLsb = p.fetch(addr, PPU_FETCH_BACKGROUND)
 
 			case 6:
 				base := p.BackgroundPatternTableBase()
-				p.bgNextTileMsb = p.PpuRead(base+uint16(p.bgNextTileID)*16+uint16(p.vramAddr.fineY)+8, true)
+				addr := base+uint16(p.bgNextTileID)*16+uint16(p.vramAddr.fineY)+8
+				if p.renderingEnabled() { p.busAddress(addr) }
+				p.bgNextTileMsb = p.fetch(addr, PPU_FETCH_BACKGROUND)
 
 			case 7:
 				incrementScrollX()
@@ -674,7 +727,7 @@ func (p *PPU) Clock() {
 		}
 
 		if p.cycle == 338 || p.cycle == 340 {
-			p.bgNextTileID = p.PpuRead(0x2000|(p.vramAddr.GetRegisters()&0x0FFF), true)
+			p.bgNextTileID = p.fetch(0x2000|(p.vramAddr.GetRegisters()&0x0FFF), PPU_FETCH_NAMETABLE)
 		}
 
 		if p.scanline == -1 && p.cycle >= 280 && p.cycle < 305 {
@@ -713,39 +766,34 @@ func (p *PPU) Clock() {
 		}
 
 		// ----------------------------------------------------------------
-		// Load sprite pattern shifters
+		// Load sprite pattern shifters, each of the 8 slots gets 8 cycles
+		// between 257 and 320 with the low and high planes fetched in the
+		// last two pairs, before the next line's background prefetch
 		// ----------------------------------------------------------------
-		if p.cycle == 340 {
-			for i := 0; i < int(p.spriteCount); i++ {
-				e := p.spriteScanLine[i]
-				row := int16(p.scanline) - int16(e.y)
+		if p.cycle >= 257 && p.cycle <= 320 {
+			slot := int((p.cycle - 257) / 8)
 
-				if e.attribute&0x80 != 0 { // vertical flip
-					row ^= 0x07
-					if p.control.spriteSize && row >= 8 {
-						row ^= 0x07
+			switch (p.cycle - 257) % 8 {
+			case 4:
+				addr := p.spritePatternAddr(slot)
+				if p.renderingEnabled() { p.busAddress(addr) }
+				data := p.fetch(addr, PPU_FETCH_SPRITE)
+				if p.scanline >= 0 && slot < int(p.spriteCount) {
+					if p.spriteScanLine[slot].attribute&0x40 != 0 { // horizontal flip
+						data = flipByte(data)
 					}
+					p.spriteShifterPatternLo[slot] = data
 				}
 
-				var addr uint16
-				if !p.control.spriteSize { // 8×8
-					addr = Btoi16(p.control.patternSprite)<<12 |
-						uint16(e.id)<<4 | uint16(row&0x07)
-				} else { // 8×16
-					tile := e.id & 0xFE
-					if row >= 8 {
-						tile++
+			case 6:
+				addr := p.spritePatternAddr(slot) + 8
+				if p.renderingEnabled() { p.busAddress(addr) }
+				data := p.fetch(addr, PPU_FETCH_SPRITE)
+				if p.scanline >= 0 && slot < int(p.spriteCount) {
+					if p.spriteScanLine[slot].attribute&0x40 != 0 {
+						data = flipByte(data)
 					}
-					table := e.id & 0x01
-					addr = uint16(table)<<12 | uint16(tile)<<4 | uint16(row&0x07)
-				}
-
-				p.spriteShifterPatternLo[i] = p.PpuRead(addr, false)
-				p.spriteShifterPatternHi[i] = p.PpuRead(addr+8, false)
-
-				if e.attribute&0x40 != 0 { // horizontal flip
-					p.spriteShifterPatternLo[i] = flipByte(p.spriteShifterPatternLo[i])
-					p.spriteShifterPatternHi[i] = flipByte(p.spriteShifterPatternHi[i])
+					p.spriteShifterPatternHi[slot] = data
 				}
 			}
 		}
@@ -851,6 +899,7 @@ func (p *PPU) Clock() {
 	//--------------------------------------------------------------------
 	// advance clocks
 	//--------------------------------------------------------------------
+	p.clockCount++
 	p.cycle++
 	if p.cycle >= 341 {
 		p.cycle = 0
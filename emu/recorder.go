@@ -0,0 +1,172 @@
+package emu
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+
+// Records the console's audio to WAV files, the mix and optionally a stem
+// for each 2A03 channel and expansion chip. Everything is resampled on the
+// emulation thread from the same clock, so all the files are the same
+// length and recording the same input always gives the same files
+
+
+// CPU cycles between writes, about a frame
+const recorderFlushCycles = 29781
+
+
+type recorderTrack struct {
+	source func() float32  // nil for the mix
+	resampler *Resampler
+	file *os.File
+	wav *WavWriter
+}
+
+
+type audioRecorder struct {
+	tracks []*recorderTrack
+	samples []float32
+	nCycles uint32
+	err error  // first write error, recording stops when set
+}
+
+
+// Returns the file name for a stem of the recording at path, "song.wav"
+// with the triangle stem is "song.triangle.wav"
+func stemPathFor(path string, name string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + "." + name + ".wav"
+}
+
+
+func (rec *audioRecorder) addTrack(path string, sampleRate int, source func() float32) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	wav, err := NewWavWriter(file, sampleRate)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	rec.tracks = append(rec.tracks, &recorderTrack{
+		source: source,
+		resampler: NewResampler(CPU_CLOCK_RATE, float64(sampleRate), sampleRate / 2),
+		file: file,
+		wav: wav,
+	})
+	return nil
+}
+
+
+func (rec *audioRecorder) clock(mix float32) {
+	if rec.err != nil {
+		return
+	}
+
+	for _, track := range rec.tracks {
+		if track.source == nil {
+			track.resampler.AddSample(mix)
+		} else {
+			track.resampler.AddSample(track.source())
+		}
+	}
+
+	rec.nCycles++
+	if rec.nCycles == recorderFlushCycles {
+		rec.nCycles = 0
+		rec.flush()
+	}
+}
+
+
+// Writes out everything the resamplers have finished
+func (rec *audioRecorder) flush() {
+	for _, track := range rec.tracks {
+		for rec.err == nil {
+			rec.samples = rec.samples[:cap(rec.samples)]
+			n := track.resampler.ReadSamples(rec.samples)
+			if n == 0 {
+				break
+			}
+			rec.err = track.wav.WriteSamples(rec.samples[:n])
+		}
+	}
+}
+
+
+func (rec *audioRecorder) close() error {
+	for _, track := range rec.tracks {
+		track.resampler.Drain()
+	}
+	rec.flush()
+	err := rec.err
+
+	for _, track := range rec.tracks {
+		if e := track.wav.Close(); e != nil && err == nil {
+			err = e
+		}
+		if e := track.file.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+
+// Starts recording the audio output to a WAV file at path, stems writes each
+// channel to its own file alongside it (see stemPathFor). Call this from
+// the goroutine clocking the bus, e.g. between frames
+func (b *Bus) StartRecording(path string, sampleRate int, stems bool) error {
+	if b.recorder != nil {
+		if err := b.StopRecording(); err != nil {
+			return err
+		}
+	}
+
+	rec := &audioRecorder{samples: make([]float32, 0, 4096)}
+	err := rec.addTrack(path, sampleRate, nil)
+
+	if stems {
+		for ch := 0; ch < APU_CHANNELS && err == nil; ch++ {
+			ch := ch
+			err = rec.addTrack(stemPathFor(path, apuChannelNames[ch]), sampleRate, func() float32 {
+				return b.Apu.ChannelOutput(ch)
+			})
+		}
+		for _, chip := range b.cart.ExpansionAudio() {
+			if err != nil {
+				break
+			}
+			chip := chip
+			err = rec.addTrack(stemPathFor(path, chip.Name()), sampleRate, func() float32 {
+				return chip.Output() * chip.Level()
+			})
+		}
+	}
+
+	if err != nil {
+		rec.close()
+		return err
+	}
+	b.recorder = rec
+	return nil
+}
+
+
+// Finishes the recording, returning any error hit while writing it
+func (b *Bus) StopRecording() error {
+	if b.recorder == nil {
+		return nil
+	}
+	err := b.recorder.close()
+	b.recorder = nil
+	return err
+}
+
+
+func (b *Bus) Recording() bool {
+	return b.recorder != nil
+}
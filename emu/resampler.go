@@ -0,0 +1,266 @@
+package emu
+
+import (
+	"math"
+	"sync"
+)
+
+
+// Converts the ~1.79MHz APU stream down to a host sample rate using band
+// limited step synthesis: the input only changes when a channel's output
+// steps, so each change is drawn into the output as a band limited step
+// rather than filtering every input sample. The result then goes through
+// the same high-pass and low-pass filters as the NES's own output stage
+
+
+const (
+	resamplerPhases = 64  // fractional positions a step can start at
+	resamplerHalfWidth = 24  // output samples either side of a step
+	resamplerPending = 64  // output samples still receiving steps, power of 2
+	resamplerCutoff = 0.45  // fraction of the output rate steps are limited to
+)
+
+
+// The NES's analog output stage, two high-pass filters and a low-pass
+var nesOutputFilters = []struct {
+	frequency float64
+	highPass bool
+}{
+	{90, true},
+	{440, true},
+	{14000, false},
+}
+
+
+// Band limited step for each phase, stored as its derivative (an impulse)
+// which is integrated when samples are read out
+var resamplerKernel [resamplerPhases][resamplerHalfWidth * 2]float32
+
+func init() {
+	const taps = resamplerHalfWidth * 2
+	for phase := 0; phase < resamplerPhases; phase++ {
+		frac := float64(phase) / resamplerPhases
+		sum := 0.0
+		var kernel [taps]float64
+
+		for i := 0; i < taps; i++ {
+			// distance from the step to this output sample
+			x := float64(i - resamplerHalfWidth + 1) - frac
+			sinc := 1.0
+			if x != 0 {
+				sinc = math.Sin(2 * math.Pi * resamplerCutoff * x) / (2 * math.Pi * resamplerCutoff * x)
+			}
+			// Blackman window across the kernel
+			w := (x + resamplerHalfWidth) / (2 * resamplerHalfWidth)
+			window := 0.42 - 0.5 * math.Cos(2 * math.Pi * w) + 0.08 * math.Cos(4 * math.Pi * w)
+			kernel[i] = sinc * window
+			sum += kernel[i]
+		}
+
+		// every step has to reach its full height
+		for i := range kernel {
+			resamplerKernel[phase][i] = float32(kernel[i] / sum)
+		}
+	}
+}
+
+
+// A first order IIR filter
+type audioFilter struct {
+	highPass bool
+	alpha float32
+	prevIn float32
+	prevOut float32
+}
+
+func newAudioFilter(frequency float64, sampleRate float64, highPass bool) audioFilter {
+	rc := 1 / (2 * math.Pi * frequency)
+	dt := 1 / sampleRate
+	filter := audioFilter{highPass: highPass}
+	if highPass {
+		filter.alpha = float32(rc / (rc + dt))
+	} else {
+		filter.alpha = float32(dt / (rc + dt))
+	}
+	return filter
+}
+
+func (f *audioFilter) process(in float32) float32 {
+	if f.highPass {
+		f.prevOut = f.alpha * (f.prevOut + in - f.prevIn)
+	} else {
+		f.prevOut += f.alpha * (in - f.prevOut)
+	}
+	f.prevIn = in
+	return f.prevOut
+}
+
+
+type Resampler struct {
+	inputRate float64
+	outputRate float64
+	ratio float64  // output samples per input sample
+
+	fTime float64  // position of the next input sample, relative to pending[nPendingStart]
+	fLast float32  // last input sample
+	pending [resamplerPending]float32  // step derivatives not yet read out
+	nPendingStart int
+	nFinished uint64  // samples integrated out of pending so far
+	fLevel float32  // running sum of the derivatives
+	filters []audioFilter
+
+	lock sync.Mutex  // guards the output buffer, written and read from different goroutines
+	buffer []float32  // ring of finished samples
+	nRead int
+	nCount int
+}
+
+
+// Creates a resampler from inputRate to outputRate (both in Hz), holding
+// up to bufferLength finished samples before the oldest are dropped
+func NewResampler(inputRate float64, outputRate float64, bufferLength int) *Resampler {
+	r := Resampler{}
+	r.inputRate = inputRate
+	r.outputRate = outputRate
+	r.ratio = outputRate / inputRate
+	r.buffer = make([]float32, bufferLength)
+	r.fTime = resamplerHalfWidth - 1
+	for _, f := range nesOutputFilters {
+		r.filters = append(r.filters, newAudioFilter(f.frequency, outputRate, f.highPass))
+	}
+	return &r
+}
+
+
+// Returns the host sample rate
+func (r *Resampler) SampleRate() float64 {
+	return r.outputRate
+}
+
+
+// Scales the output rate by adjust (close to 1) without changing
+// SampleRate, used to track an audio device running slightly fast or slow
+func (r *Resampler) SetRateAdjust(adjust float64) {
+	r.ratio = r.outputRate * adjust / r.inputRate
+}
+
+
+// Adds the next input sample
+func (r *Resampler) AddSample(sample float32) {
+	if delta := sample - r.fLast; delta != 0 {
+		r.fLast = sample
+		r.addStep(delta)
+	}
+
+	r.fTime += r.ratio
+	// samples more than half a kernel behind can't receive any more steps
+	for r.fTime >= resamplerHalfWidth {
+		r.finish()
+		r.fTime--
+	}
+}
+
+
+func (r *Resampler) addStep(delta float32) {
+	whole := int(r.fTime)
+	phase := int((r.fTime - float64(whole)) * resamplerPhases)
+	start := r.nPendingStart + whole - resamplerHalfWidth + 1
+
+	for i, k := range resamplerKernel[phase] {
+		r.pending[(start + i) & (resamplerPending - 1)] += delta * k
+	}
+}
+
+
+// Finishes the samples still receiving band limited steps by holding the
+// input at its last value, e.g. at the end of a recording. Always finishes
+// a whole kernel's worth so resamplers drained together stay the same length
+func (r *Resampler) Drain() {
+	target := r.nFinished + resamplerHalfWidth * 2
+	for r.nFinished < target {
+		r.AddSample(r.fLast)
+	}
+}
+
+
+// Integrates and filters the oldest pending sample into the output buffer
+func (r *Resampler) finish() {
+	r.fLevel += r.pending[r.nPendingStart]
+	r.pending[r.nPendingStart] = 0
+	r.nPendingStart = (r.nPendingStart + 1) & (resamplerPending - 1)
+	r.nFinished++
+
+	out := r.fLevel
+	for i := range r.filters {
+		out = r.filters[i].process(out)
+	}
+
+	r.lock.Lock()
+	if r.nCount == len(r.buffer) {  // nobody is reading, drop the oldest
+		r.nRead = (r.nRead + 1) % len(r.buffer)
+		r.nCount--
+	}
+	r.buffer[(r.nRead + r.nCount) % len(r.buffer)] = out
+	r.nCount++
+	r.lock.Unlock()
+}
+
+
+// Returns how many finished samples are waiting to be read
+func (r *Resampler) Available() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.nCount
+}
+
+
+// Copies out as many finished samples as fit in out, returning the count
+func (r *Resampler) ReadSamples(out []float32) int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	n := 0
+	for n < len(out) && r.nCount > 0 {
+		out[n] = r.buffer[r.nRead]
+		r.nRead = (r.nRead + 1) % len(r.buffer)
+		r.nCount--
+		n++
+	}
+	return n
+}
+
+
+// As ReadSamples, but as signed 16 bit PCM
+func (r *Resampler) ReadSamplesInt16(out []int16) int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	n := 0
+	for n < len(out) && r.nCount > 0 {
+		out[n] = sampleToInt16(r.buffer[r.nRead])
+		r.nRead = (r.nRead + 1) % len(r.buffer)
+		r.nCount--
+		n++
+	}
+	return n
+}
+
+
+// Clips a sample to -1 to 1 and converts it to 16 bit PCM
+func sampleToInt16(sample float32) int16 {
+	if sample > 1 {
+		sample = 1
+	} else if sample < -1 {
+		sample = -1
+	}
+	return int16(sample * 32767)
+}
+
+
+// Discards any finished samples
+func (r *Resampler) Clear() {
+	r.lock.Lock()
+	r.nRead = 0
+	r.nCount = 0
+	r.lock.Unlock()
+}
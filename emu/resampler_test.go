@@ -0,0 +1,79 @@
+package emu
+
+import (
+	"math"
+	"testing"
+)
+
+
+// Feeds pure tones at the APU rate through the resampler and measures the
+// output spectrum. Tones in the audible range should come through at close
+// to full level (less the NES output filters), tones above the host's
+// Nyquist frequency should be filtered out instead of aliasing back
+
+const (
+	spectrumAmplitude = 0.25
+	spectrumSettleTime = 0.25  // seconds for the high-pass filters to settle before measuring
+	spectrumMeasureTime = 1.0
+	spectrumMaxAliasDb = -60.0
+)
+
+
+// Runs a sine wave through a resampler and returns the settled output
+func resampleTone(frequency float64, rate float64) []float32 {
+	seconds := spectrumSettleTime + spectrumMeasureTime
+	total := int(seconds * rate) + 1
+	r := NewResampler(CPU_CLOCK_RATE, rate, total)
+
+	inputs := int(seconds * CPU_CLOCK_RATE) + 4096
+	step := 2 * math.Pi * frequency / CPU_CLOCK_RATE
+	for i := 0; i < inputs; i++ {
+		r.AddSample(float32(spectrumAmplitude * math.Sin(step * float64(i))))
+	}
+
+	out := make([]float32, total)
+	n := r.ReadSamples(out)
+	return out[int(spectrumSettleTime * rate):n]
+}
+
+
+// Level of a single frequency in dB relative to the input amplitude,
+// using the Goertzel algorithm over a Hann windowed block
+func toneLevel(samples []float32, frequency float64, rate float64) float64 {
+	n := len(samples)
+	coeff := 2 * math.Cos(2 * math.Pi * frequency / rate)
+	var s1, s2, windowSum float64
+
+	for i, sample := range samples {
+		window := 0.5 - 0.5 * math.Cos(2 * math.Pi * float64(i) / float64(n - 1))
+		windowSum += window
+		s := float64(sample) * window + coeff * s1 - s2
+		s2 = s1
+		s1 = s
+	}
+
+	power := s1 * s1 + s2 * s2 - coeff * s1 * s2
+	magnitude := 2 * math.Sqrt(power) / windowSum
+	return 20 * math.Log10(magnitude / spectrumAmplitude)
+}
+
+
+func TestResamplerSpectrum(t *testing.T) {
+	for _, rate := range []float64{44100, 48000} {
+		for _, tone := range []float64{1000, 5000, 12000} {
+			db := toneLevel(resampleTone(tone, rate), tone, rate)
+			if db < -6 || db > 0.5 {
+				t.Errorf("%.0f Hz: %.0f Hz tone at %.1f dB, want -6 to 0.5 dB", rate, tone, db)
+			}
+		}
+
+		// tones above Nyquist would fold back to rate - tone
+		for _, tone := range []float64{30000, 40000} {
+			alias := math.Abs(rate - tone)
+			db := toneLevel(resampleTone(tone, rate), alias, rate)
+			if db > spectrumMaxAliasDb {
+				t.Errorf("%.0f Hz: %.0f Hz tone aliases to %.0f Hz at %.1f dB, want below %.0f dB", rate, tone, alias, db, spectrumMaxAliasDb)
+			}
+		}
+	}
+}
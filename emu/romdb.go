@@ -0,0 +1,323 @@
+package emu
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+/*
+ROM database format
+
+One game per line, blank lines and lines starting with # are ignored.
+A line starts with the CRC32 of PRG-ROM followed by CHR-ROM (in hex, no
+header or trainer) and is followed by any number of key=value fields:
+
+	crc32 [key=value ...]
+
+	title=      game title, quote it if it contains spaces
+	sha1=       SHA-1 of PRG+CHR, when given it must also match
+	mapper=     mapper number
+	submapper=  NES 2.0 submapper
+	mirror=     h (horizontal), v (vertical) or 4 (four-screen)
+	battery=    1 if PRG-RAM is battery backed, 0 if not
+	prgram=     volatile PRG-RAM size, in bytes or with a k suffix (8k)
+	prgnvram=   battery backed PRG-RAM size
+	chrram=     CHR-RAM size
+	timing=     ntsc, pal, multi or dendy
+
+Fields that are left out keep the value from the ROM header. For example
+
+	1A2B3C4D title="Some Game (USA)" mapper=1 mirror=v prgnvram=8k
+
+Local databases in the same format can be merged with RomDatabase.Load.
+*/
+
+
+// A single game in the ROM database, numeric fields are -1 when unspecified
+type RomDatabaseEntry struct {
+	Crc32 uint32
+	Sha1 string  // upper case hex, empty if unspecified
+	Title string
+
+	Mapper int
+	SubMapper int
+	Mirror int  // HORIZONTAL, VERTICAL or FOURSCREEN
+	Battery int
+	PrgRamSize int
+	PrgNvramSize int
+	ChrRamSize int
+	Timing int
+}
+
+
+// Result of looking a cartridge up in the database
+type RomDatabaseResult struct {
+	Crc32 uint32  // CRC32 of PRG+CHR
+	Sha1 string  // SHA-1 of PRG+CHR
+	Matched bool  // an entry was found
+	Title string
+	Overridden bool  // the entry changed at least one header field
+}
+
+
+type RomDatabase struct {
+	entries map[uint32][]RomDatabaseEntry
+}
+
+
+// The database consulted when loading ROMs, set to nil to trust headers as-is.
+// Out of the box it knows only the bundled test ROMs, see romdb_data.go
+var DefaultRomDatabase = mustParseRomDatabase(builtinRomDatabase)
+
+
+func NewRomDatabase() *RomDatabase {
+	return &RomDatabase{entries: make(map[uint32][]RomDatabaseEntry)}
+}
+
+
+func ParseRomDatabase(r io.Reader) (*RomDatabase, error) {
+	db := NewRomDatabase()
+	if err := db.Load(r); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+
+func mustParseRomDatabase(text string) *RomDatabase {
+	db, err := ParseRomDatabase(strings.NewReader(text))
+	if err != nil {
+		panic(err)
+	}
+	return db
+}
+
+
+// Merges entries into the database, later entries for the same hash replace earlier ones
+func (db *RomDatabase) Load(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		entry, err := parseRomDatabaseLine(line)
+		if err != nil {
+			return fmt.Errorf("rom database line %d: %w", lineNum, err)
+		}
+		db.Add(entry)
+	}
+	return scanner.Err()
+}
+
+
+func (db *RomDatabase) Add(entry RomDatabaseEntry) {
+	existing := db.entries[entry.Crc32]
+	for i := range existing {
+		if existing[i].Sha1 == entry.Sha1 {
+			existing[i] = entry
+			return
+		}
+	}
+	db.entries[entry.Crc32] = append(existing, entry)
+}
+
+
+// Finds the entry for a PRG+CHR hash, entries with a SHA-1 must match it too
+func (db *RomDatabase) Lookup(crc uint32, sha string) (RomDatabaseEntry, bool) {
+	var fallback *RomDatabaseEntry
+	for i, entry := range db.entries[crc] {
+		if entry.Sha1 == "" {
+			fallback = &db.entries[crc][i]
+		} else if entry.Sha1 == sha {
+			return entry, true
+		}
+	}
+	if fallback != nil {
+		return *fallback, true
+	}
+	return RomDatabaseEntry{}, false
+}
+
+
+// Splits a line into fields, honouring double quoted values
+func splitRomDatabaseLine(line string) ([]string, error) {
+	var fields []string
+	var field strings.Builder
+	inQuotes := false
+
+	for _, c := range line {
+		switch {
+		case c == '"':
+			inQuotes = !inQuotes
+			field.WriteRune(c)
+		case unicode.IsSpace(c) && !inQuotes:
+			if field.Len() > 0 {
+				fields = append(fields, field.String())
+				field.Reset()
+			}
+		default:
+			field.WriteRune(c)
+		}
+	}
+	if inQuotes {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	if field.Len() > 0 {
+		fields = append(fields, field.String())
+	}
+	return fields, nil
+}
+
+
+func parseRomDatabaseLine(line string) (RomDatabaseEntry, error) {
+	entry := RomDatabaseEntry{
+		Mapper: -1, SubMapper: -1, Mirror: -1, Battery: -1,
+		PrgRamSize: -1, PrgNvramSize: -1, ChrRamSize: -1, Timing: -1,
+	}
+
+	fields, err := splitRomDatabaseLine(line)
+	if err != nil {
+		return entry, err
+	}
+
+	crc, err := strconv.ParseUint(fields[0], 16, 32)
+	if err != nil {
+		return entry, fmt.Errorf("bad crc32 %q", fields[0])
+	}
+	entry.Crc32 = uint32(crc)
+
+	for _, field := range fields[1:] {
+		eq := strings.IndexByte(field, '=')
+		if eq < 0 {
+			return entry, fmt.Errorf("expected key=value, got %q", field)
+		}
+		key := strings.ToLower(field[:eq])
+		value := field[eq+1:]
+		if strings.HasPrefix(value, "\"") {
+			if value, err = strconv.Unquote(value); err != nil {
+				return entry, fmt.Errorf("bad quoted value for %s", key)
+			}
+		}
+
+		switch key {
+		case "title":
+			entry.Title = value
+		case "sha1":
+			entry.Sha1 = strings.ToUpper(value)
+		case "mapper":
+			entry.Mapper, err = strconv.Atoi(value)
+		case "submapper":
+			entry.SubMapper, err = strconv.Atoi(value)
+		case "battery":
+			entry.Battery, err = strconv.Atoi(value)
+		case "prgram":
+			entry.PrgRamSize, err = parseRomDatabaseSize(value)
+		case "prgnvram":
+			entry.PrgNvramSize, err = parseRomDatabaseSize(value)
+		case "chrram":
+			entry.ChrRamSize, err = parseRomDatabaseSize(value)
+		case "mirror":
+			switch strings.ToLower(value) {
+			case "h":
+				entry.Mirror = HORIZONTAL
+			case "v":
+				entry.Mirror = VERTICAL
+			case "4":
+				entry.Mirror = FOURSCREEN
+			default:
+				err = fmt.Errorf("unknown mirroring %q", value)
+			}
+		case "timing":
+			switch strings.ToLower(value) {
+			case "ntsc":
+				entry.Timing = TIMING_NTSC
+			case "pal":
+				entry.Timing = TIMING_PAL
+			case "multi":
+				entry.Timing = TIMING_MULTI
+			case "dendy":
+				entry.Timing = TIMING_DENDY
+			default:
+				err = fmt.Errorf("unknown timing %q", value)
+			}
+		default:
+			err = fmt.Errorf("unknown field %q", key)
+		}
+		if err != nil {
+			return entry, err
+		}
+	}
+
+	return entry, nil
+}
+
+
+func parseRomDatabaseSize(value string) (int, error) {
+	multiplier := 1
+	if strings.HasSuffix(strings.ToLower(value), "k") {
+		multiplier = 1024
+		value = value[:len(value)-1]
+	}
+	n, err := strconv.Atoi(value)
+	return n * multiplier, err
+}
+
+
+// Hashes PRG+CHR ROM the same way the database is keyed
+func hashRomData(prg []uint8, chr []uint8) (uint32, string) {
+	crc := crc32.ChecksumIEEE(prg)
+	crc = crc32.Update(crc, crc32.IEEETable, chr)
+
+	h := sha1.New()
+	h.Write(prg)
+	h.Write(chr)
+	return crc, strings.ToUpper(hex.EncodeToString(h.Sum(nil)))
+}
+
+
+// Overrides header fields with those given by the entry, reporting if anything changed
+func (entry *RomDatabaseEntry) apply(info *RomInfo) bool {
+	before := *info
+
+	if entry.Mapper >= 0 {
+		info.Mapper = uint16(entry.Mapper)
+	}
+	if entry.SubMapper >= 0 {
+		info.SubMapper = uint8(entry.SubMapper)
+	}
+	switch entry.Mirror {
+	case HORIZONTAL, VERTICAL:
+		info.Mirror = entry.Mirror
+		info.FourScreen = false
+	case FOURSCREEN:
+		info.FourScreen = true
+	}
+	if entry.Battery >= 0 {
+		info.Battery = entry.Battery != 0
+	}
+	if entry.PrgRamSize >= 0 {
+		info.PrgRamSize = uint32(entry.PrgRamSize)
+	}
+	if entry.PrgNvramSize >= 0 {
+		info.PrgNvramSize = uint32(entry.PrgNvramSize)
+	}
+	if entry.ChrRamSize >= 0 {
+		info.ChrRamSize = uint32(entry.ChrRamSize)
+	}
+	if entry.Timing >= 0 {
+		info.Timing = entry.Timing
+	}
+
+	return *info != before
+}
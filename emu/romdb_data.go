@@ -0,0 +1,13 @@
+package emu
+
+
+// Built in ROM database, see romdb.go for the format. It only holds the
+// test ROMs shipped in ROMS/, whose headers are already correct, so it
+// serves as an example of the format and corrects no games. Corrections for
+// bad dumps come from a local database merged in with
+// DefaultRomDatabase.Load, e.g. one converted from NesCartDB
+const builtinRomDatabase = `
+# Test ROMs
+158B0388 sha1=4131307F0F69F2A5C54B7D438328C5B2A5ED0820 title="nestest" mapper=0 mirror=h
+1F89B8C6 sha1=A20C944484A85A04B9A6D981452166E8675DAC05 title="palette_fill_novblank" mapper=0
+`
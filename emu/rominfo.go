@@ -0,0 +1,165 @@
+package emu
+
+
+// ROM file formats
+const (
+	FORMAT_INES = iota
+	FORMAT_NES20
+	FORMAT_UNIF
+	FORMAT_FDS  // Famicom Disk System image, see LoadFdsCartridge
+)
+
+// CPU/PPU timing regions
+const (
+	TIMING_NTSC = iota
+	TIMING_PAL
+	TIMING_MULTI  // runs on both NTSC and PAL machines
+	TIMING_DENDY
+)
+
+// Console types
+const (
+	CONSOLE_NES = iota  // NES / Famicom
+	CONSOLE_VS  // Vs. System
+	CONSOLE_PLAYCHOICE  // PlayChoice-10
+	CONSOLE_EXTENDED  // see ExtendedConsoleType
+)
+
+
+// Describes a ROM image as given by its header
+type RomInfo struct {
+	Format int  // FORMAT_INES, FORMAT_NES20, FORMAT_UNIF or FORMAT_FDS
+	Board string  // UNIF board name, empty for iNES
+	Mapper uint16  // 12-bit mapper number (8-bit for iNES)
+	SubMapper uint8  // NES 2.0 only
+
+	PrgRomSize uint32  // sizes are all in bytes
+	ChrRomSize uint32
+	PrgRamSize uint32  // volatile PRG-RAM
+	PrgNvramSize uint32  // battery backed PRG-RAM
+	ChrRamSize uint32
+	ChrNvramSize uint32
+
+	Mirror int  // HORIZONTAL or VERTICAL as wired on the board
+	FourScreen bool  // board supplies its own nametable VRAM
+	Battery bool  // board has battery backed memory
+	Trainer bool  // 512 byte trainer precedes PRG-ROM
+
+	Timing int
+	ConsoleType int
+	VsPpuType uint8
+	VsHardwareType uint8
+	ExtendedConsoleType uint8
+	MiscRoms uint8  // number of miscellaneous ROMs after CHR-ROM
+	ExpansionDevice uint8  // default expansion device, 0 is unspecified
+}
+
+
+// Decodes an iNES or NES 2.0 header
+func parseRomInfo(h sHeader) (RomInfo, error) {
+	info := RomInfo{}
+	var err error
+
+	info.Mirror = HORIZONTAL
+	if h.Mapper1 & 0x01 != 0 {
+		info.Mirror = VERTICAL
+	}
+	info.Battery = h.Mapper1 & 0x02 != 0
+	info.Trainer = h.Mapper1 & 0x04 != 0
+	info.FourScreen = h.Mapper1 & 0x08 != 0
+	info.ConsoleType = int(h.Mapper2 & 0x03)
+
+	if (h.Mapper2 & 0x0C) == 0x08 {
+		info.Format = FORMAT_NES20
+
+		info.Mapper = uint16(h.PrgRamSize & 0x0F) << 8 |
+				uint16(h.Mapper2 & 0xF0) |
+				uint16(h.Mapper1 >> 4)
+		info.SubMapper = h.PrgRamSize >> 4
+
+		info.PrgRomSize, err = nes20RomSize("PRG-ROM", h.PrgRomChunks, h.TvSystem1 & 0x0F, 16384)
+		if err != nil {
+			return info, err
+		}
+		info.ChrRomSize, err = nes20RomSize("CHR-ROM", h.ChrRomChunks, h.TvSystem1 >> 4, 8192)
+		if err != nil {
+			return info, err
+		}
+
+		info.PrgRamSize = nes20RamSize(h.TvSystem2 & 0x0F)
+		info.PrgNvramSize = nes20RamSize(h.TvSystem2 >> 4)
+		info.ChrRamSize = nes20RamSize(h.Unused[0] & 0x0F)
+		info.ChrNvramSize = nes20RamSize(h.Unused[0] >> 4)
+
+		info.Timing = int(h.Unused[1] & 0x03)
+
+		switch info.ConsoleType {
+		case CONSOLE_VS:
+			info.VsPpuType = h.Unused[2] & 0x0F
+			info.VsHardwareType = h.Unused[2] >> 4
+		case CONSOLE_EXTENDED:
+			info.ExtendedConsoleType = h.Unused[2] & 0x0F
+		}
+
+		info.MiscRoms = h.Unused[3] & 0x03
+		info.ExpansionDevice = h.Unused[4] & 0x3F
+	} else {
+		info.Format = FORMAT_INES
+
+		info.Mapper = uint16(h.Mapper1 >> 4)
+		// old dumping tools wrote junk in bytes 7-15, in which case
+		// the upper mapper nibble can't be trusted
+		if h.Unused[1] | h.Unused[2] | h.Unused[3] | h.Unused[4] == 0 {
+			info.Mapper |= uint16(h.Mapper2 & 0xF0)
+		}
+
+		info.PrgRomSize = uint32(h.PrgRomChunks) * 16384
+		info.ChrRomSize = uint32(h.ChrRomChunks) * 8192
+
+		// a value of 0 infers 8K for compatibility
+		ramSize := uint32(h.PrgRamSize) * 8192
+		if ramSize == 0 {
+			ramSize = 8192
+		}
+		if info.Battery {
+			info.PrgNvramSize = ramSize
+		} else {
+			info.PrgRamSize = ramSize
+		}
+
+		if info.ChrRomSize == 0 {
+			info.ChrRamSize = 8192
+		}
+
+		if h.TvSystem1 & 0x01 != 0 {
+			info.Timing = TIMING_PAL
+		}
+	}
+
+	return info, nil
+}
+
+
+// ROM sizes either count banks, or when the MSB nibble is $F encode
+// the size as 2^E * (MM*2+1) from the LSB byte EEEEEEMM. E goes up to 63,
+// sizes that don't fit in 32 bits are an error rather than wrapping
+func nes20RomSize(section string, lsb uint8, msb uint8, bankSize uint32) (uint32, error) {
+	if msb == 0x0F {
+		exponent := lsb >> 2
+		multiplier := (lsb & 0x03) * 2 + 1
+		if exponent >= 32 || uint64(1) << exponent * uint64(multiplier) > 0xFFFFFFFF {
+			return 0, &ErrRomSizeOverflow{Section: section, Exponent: exponent, Multiplier: multiplier}
+		}
+		return uint32(1) << exponent * uint32(multiplier), nil
+	}
+	return (uint32(msb) << 8 | uint32(lsb)) * bankSize, nil
+}
+
+
+// RAM sizes are stored as a shift count, 64 << shift bytes
+func nes20RamSize(shift uint8) uint32 {
+	if shift == 0 {
+		return 0
+	}
+	return 64 << shift
+}
@@ -0,0 +1,215 @@
+package emu
+
+import (
+	"math"
+)
+
+
+// Sunsoft 5B, the FME-7 with a YM2149F (AY-3-8910 family) sound core.
+// The core runs at half the CPU clock and divides by 8 again before its
+// tone, noise and envelope counters, so everything ticks every 16 CPU cycles
+type Sunsoft5B struct {
+	nAddress uint8
+	registers [16]uint8
+
+	nPrescaler uint8
+	pToneCounter [3]uint16
+	pToneOutput [3]bool
+
+	nNoiseCounter uint8
+	bNoiseHalf bool  // the noise LFSR is clocked at half the tone rate
+	nNoiseShift uint32
+
+	nEnvelopeCounter uint16
+	nEnvelopeStep uint8  // 0-31
+	bEnvelopeAttack bool  // counting up
+	bEnvelopeHolding bool
+}
+
+
+// Output level for each 5 bit volume, 1.5dB per step with 0 silent
+var sunsoft5BLevels [32]float32
+
+func init() {
+	for i := 1; i < 32; i++ {
+		sunsoft5BLevels[i] = float32(math.Pow(10, float64(i - 31) * 1.5 / 20))
+	}
+}
+
+
+func NewSunsoft5B() *Sunsoft5B {
+	chip := Sunsoft5B{}
+	chip.Reset()
+	return &chip
+}
+
+
+// $C000-$DFFF selects a register
+func (s *Sunsoft5B) WriteAddress(data uint8) {
+	s.nAddress = data & 0x0F
+}
+
+
+// $E000-$FFFF writes the selected register
+func (s *Sunsoft5B) WriteData(data uint8) {
+	s.registers[s.nAddress] = data
+	if s.nAddress == 13 {  // writing the envelope shape restarts it
+		s.nEnvelopeCounter = 0
+		s.nEnvelopeStep = 0
+		s.bEnvelopeAttack = data & 0x04 != 0
+		s.bEnvelopeHolding = false
+	}
+}
+
+
+func (s *Sunsoft5B) tonePeriod(channel int) uint16 {
+	period := uint16(s.registers[channel * 2]) | uint16(s.registers[channel * 2 + 1] & 0x0F) << 8
+	if period == 0 {
+		period = 1
+	}
+	return period
+}
+
+
+func (s *Sunsoft5B) envelopePeriod() uint16 {
+	period := uint16(s.registers[11]) | uint16(s.registers[12]) << 8
+	if period == 0 {
+		period = 1
+	}
+	return period
+}
+
+
+// Advances the chip by one CPU cycle
+func (s *Sunsoft5B) Clock() {
+	s.nPrescaler++
+	if s.nPrescaler < 16 {
+		return
+	}
+	s.nPrescaler = 0
+
+	for ch := 0; ch < 3; ch++ {
+		s.pToneCounter[ch]++
+		if s.pToneCounter[ch] >= s.tonePeriod(ch) {
+			s.pToneCounter[ch] = 0
+			s.pToneOutput[ch] = !s.pToneOutput[ch]
+		}
+	}
+
+	noisePeriod := s.registers[6] & 0x1F
+	if noisePeriod == 0 {
+		noisePeriod = 1
+	}
+	s.nNoiseCounter++
+	if s.nNoiseCounter >= noisePeriod {
+		s.nNoiseCounter = 0
+		s.bNoiseHalf = !s.bNoiseHalf
+		if s.bNoiseHalf {
+			// 17 bit LFSR, taps at bits 0 and 3
+			feedback := (s.nNoiseShift ^ (s.nNoiseShift >> 3)) & 0x01
+			s.nNoiseShift = (s.nNoiseShift >> 1) | feedback << 16
+		}
+	}
+
+	s.nEnvelopeCounter++
+	if s.nEnvelopeCounter >= s.envelopePeriod() {
+		s.nEnvelopeCounter = 0
+		s.clockEnvelope()
+	}
+}
+
+
+// Steps the envelope through one of the shapes selected by register 13,
+// bits are continue, attack, alternate and hold
+func (s *Sunsoft5B) clockEnvelope() {
+	if s.bEnvelopeHolding {
+		return
+	}
+
+	s.nEnvelopeStep++
+	if s.nEnvelopeStep < 32 {
+		return
+	}
+
+	shape := s.registers[13]
+	switch {
+	case shape & 0x08 == 0:  // single ramp then silence
+		s.bEnvelopeHolding = true
+		s.bEnvelopeAttack = false
+		s.nEnvelopeStep = 31
+	case shape & 0x01 != 0:  // hold at the end, or the start when alternating
+		s.bEnvelopeHolding = true
+		if shape & 0x02 != 0 {
+			s.bEnvelopeAttack = !s.bEnvelopeAttack
+		}
+		s.nEnvelopeStep = 31
+	default:
+		if shape & 0x02 != 0 {
+			s.bEnvelopeAttack = !s.bEnvelopeAttack
+		}
+		s.nEnvelopeStep = 0
+	}
+}
+
+
+func (s *Sunsoft5B) envelopeLevel() uint8 {
+	if s.bEnvelopeAttack {
+		return s.nEnvelopeStep
+	}
+	return 31 - s.nEnvelopeStep
+}
+
+
+// Returns the mix of the three channels, from 0 to 1
+func (s *Sunsoft5B) Output() float32 {
+	mixer := s.registers[7]
+	noise := s.nNoiseShift & 0x01 != 0
+	out := float32(0)
+
+	for ch := 0; ch < 3; ch++ {
+		toneOff := mixer & (1 << ch) != 0
+		noiseOff := mixer & (8 << ch) != 0
+		if !((s.pToneOutput[ch] || toneOff) && (noise || noiseOff)) {
+			continue
+		}
+
+		volume := s.registers[8 + ch]
+		if volume & 0x10 != 0 {
+			out += sunsoft5BLevels[s.envelopeLevel()]
+		} else if volume & 0x0F != 0 {
+			// 4 bit volumes land on every other step of the 5 bit scale
+			out += sunsoft5BLevels[(volume & 0x0F) * 2 + 1]
+		}
+	}
+
+	return out / 3
+}
+
+
+// The 5B is loud, a single channel at full volume is a bit louder than a
+// 2A03 pulse channel
+func (s *Sunsoft5B) Level() float32 {
+	return 0.75
+}
+
+
+func (s *Sunsoft5B) Name() string {
+	return "5b"
+}
+
+
+func (s *Sunsoft5B) Reset() {
+	s.nAddress = 0
+	s.registers = [16]uint8{}
+	s.registers[7] = 0x3F  // everything muted
+	s.nPrescaler = 0
+	s.pToneCounter = [3]uint16{}
+	s.pToneOutput = [3]bool{}
+	s.nNoiseCounter = 0
+	s.bNoiseHalf = false
+	s.nNoiseShift = 1
+	s.nEnvelopeCounter = 0
+	s.nEnvelopeStep = 0
+	s.bEnvelopeAttack = false
+	s.bEnvelopeHolding = true
+}
@@ -0,0 +1,249 @@
+package emu
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+)
+
+
+// UNIF images start with a 32 byte header ("UNIF", a revision number and
+// padding) followed by chunks of a 4 character ID, a 32 bit little endian
+// length and the data. Rather than a mapper number the board is named in
+// the MAPR chunk, which is mapped onto a registered mapper
+const unifMagic = "UNIF"
+const unifHeaderSize = 32
+
+
+var ErrNoUnifBoard = errors.New("UNIF image has no MAPR chunk")
+
+
+// The mapper emulating a UNIF board
+type UnifBoard struct {
+	Mapper uint16
+	SubMapper uint8
+}
+
+
+var unifBoards = struct {
+	sync.RWMutex
+	boards map[string]UnifBoard
+}{boards: map[string]UnifBoard{
+	"NROM": {0, 0}, "NROM-128": {0, 0}, "NROM-256": {0, 0}, "RROM": {0, 0},
+
+	"SAROM": {1, 0}, "SBROM": {1, 0}, "SCROM": {1, 0}, "SEROM": {1, 0},
+	"SGROM": {1, 0}, "SKROM": {1, 0}, "SLROM": {1, 0}, "SL1ROM": {1, 0},
+	"SNROM": {1, 0}, "SOROM": {1, 0}, "SUROM": {1, 0}, "SXROM": {1, 0},
+
+	"UNROM": {2, 0}, "UOROM": {2, 0},
+	"CNROM": {3, 0},
+
+	"TBROM": {4, 0}, "TEROM": {4, 0}, "TFROM": {4, 0}, "TGROM": {4, 0},
+	"TKROM": {4, 0}, "TLROM": {4, 0}, "TL1ROM": {4, 0}, "TR1ROM": {4, 0},
+	"TSROM": {4, 0}, "TVROM": {4, 0}, "HKROM": {4, 0},
+
+	"EKROM": {5, 0}, "ELROM": {5, 0}, "ETROM": {5, 0}, "EWROM": {5, 0},
+
+	"AMROM": {7, 0}, "ANROM": {7, 0}, "AOROM": {7, 0},
+	"PNROM": {9, 0}, "PEEOROM": {9, 0},
+	"FJROM": {10, 0}, "FKROM": {10, 0},
+
+	"BNROM": {34, 2},
+	"NINA-001": {34, 1},
+	"GNROM": {66, 0}, "MHROM": {66, 0},
+	"JLROM": {69, 0}, "JSROM": {69, 0}, "BTR": {69, 0},
+
+	"DEROM": {206, 0}, "DE1ROM": {206, 0}, "DRROM": {206, 0},
+}}
+
+
+// Board names carry a prefix for the manufacturer or licensing status
+// which doesn't affect the hardware, e.g. "NES-SLROM" and "HVC-SLROM"
+var unifBoardPrefixes = []string{"NES-", "HVC-", "UNL-", "BMC-", "BTL-", "IREM-", "KONAMI-", "NAMCOT-", "SUNSOFT-", "TAITO-"}
+
+func unifBoardKey(name string) string {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	for _, prefix := range unifBoardPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return name[len(prefix):]
+		}
+	}
+	return name
+}
+
+
+// Maps a UNIF board name to a mapper, the name's manufacturer prefix
+// (NES-, UNL-, BMC- ...) is ignored. Registering a board again replaces it
+func RegisterUnifBoard(name string, board UnifBoard) {
+	unifBoards.Lock()
+	defer unifBoards.Unlock()
+	unifBoards.boards[unifBoardKey(name)] = board
+}
+
+
+func lookupUnifBoard(name string) (UnifBoard, bool) {
+	unifBoards.RLock()
+	defer unifBoards.RUnlock()
+	board, ok := unifBoards.boards[unifBoardKey(name)]
+	return board, ok
+}
+
+
+// Loads a UNIF image from r
+func loadUNIF(r io.Reader) (*Cartridge, error) {
+	var header [unifHeaderSize]uint8
+	n, err := io.ReadFull(r, header[:])
+	if err != nil {
+		return nil, readError(err, "UNIF header", len(header), n)
+	}
+	if string(header[:4]) != unifMagic {
+		return nil, ErrBadMagic
+	}
+
+	var prg, chr [16][]uint8
+	var boardName string
+	var mirr = -1
+	var battery, chrIsRam bool
+	timing := TIMING_NTSC
+
+	br := bufio.NewReader(r)
+	for {
+		var chunkHeader [8]uint8
+		n, err := io.ReadFull(br, chunkHeader[:])
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, readError(err, "UNIF chunk header", len(chunkHeader), n)
+		}
+
+		id := string(chunkHeader[:4])
+		length := binary.LittleEndian.Uint32(chunkHeader[4:])
+		data, err := ioutil.ReadAll(io.LimitReader(br, int64(length)))
+		if err != nil {
+			return nil, err
+		}
+		if uint32(len(data)) != length {
+			return nil, &ErrTruncated{Section: id + " chunk", Want: int(length), Got: len(data)}
+		}
+
+		switch {
+		case id == "MAPR":
+			boardName = strings.TrimRight(string(data), "\x00")
+		case strings.HasPrefix(id, "PRG") || strings.HasPrefix(id, "CHR"):
+			var index int
+			if _, err := fmt.Sscanf(id[3:], "%X", &index); err != nil {
+				continue  // unknown chunk, skip it
+			}
+			if id[0] == 'P' {
+				prg[index] = data
+			} else {
+				chr[index] = data
+			}
+		case id == "MIRR" && len(data) > 0:
+			mirr = int(data[0])
+		case id == "BATR":
+			battery = len(data) == 0 || data[0] != 0
+		case id == "VROR":
+			chrIsRam = len(data) == 0 || data[0] != 0
+		case id == "TVCI" && len(data) > 0:
+			switch data[0] {
+			case 1:
+				timing = TIMING_PAL
+			case 2:
+				timing = TIMING_MULTI
+			}
+		}
+		// NAME, READ, DINF, CTRL and the PCKn/CCKn checksums are informational
+	}
+
+	if boardName == "" {
+		return nil, ErrNoUnifBoard
+	}
+	board, ok := lookupUnifBoard(boardName)
+	if !ok {
+		return nil, &ErrUnsupportedBoard{Board: boardName}
+	}
+
+	cart := Cartridge{}
+	cart.prgMemory = padRom(concatChunks(prg[:]), 16384)
+	chrData := padRom(concatChunks(chr[:]), 8192)
+
+	info := RomInfo{Format: FORMAT_UNIF, Board: boardName}
+	info.Mapper = board.Mapper
+	info.SubMapper = board.SubMapper
+	info.PrgRomSize = uint32(len(cart.prgMemory))
+	info.Timing = timing
+	info.Battery = battery
+
+	var chrRom []uint8
+	if len(chrData) == 0 || chrIsRam {
+		info.ChrRamSize = 8192
+		if uint32(len(chrData)) > info.ChrRamSize {
+			info.ChrRamSize = uint32(len(chrData))
+		}
+	} else {
+		chrRom = chrData
+		info.ChrRomSize = uint32(len(chrRom))
+	}
+
+	// UNIF has no RAM sizes, assume the usual 8K
+	if battery {
+		info.PrgNvramSize = 8192
+	} else {
+		info.PrgRamSize = 8192
+	}
+
+	switch mirr {
+	case 0:
+		info.Mirror = HORIZONTAL
+	case 1:
+		info.Mirror = VERTICAL
+	case 2:
+		info.Mirror = ONESCREEN_LO
+	case 3:
+		info.Mirror = ONESCREEN_HI
+	case 4:
+		info.FourScreen = true
+	default:  // 5 or missing, left to the mapper
+		info.Mirror = HORIZONTAL
+	}
+
+	cart.info = info
+	if err := cart.setup(chrRom, nil); err != nil {
+		return nil, err
+	}
+	if chrRom == nil {
+		copy(cart.chrMemory, chrData)  // VROR, the CHR chunks preload CHR-RAM
+	}
+	return &cart, nil
+}
+
+
+// Joins the PRGn/CHRn chunks in order, gaps are skipped
+func concatChunks(chunks [][]uint8) []uint8 {
+	var out []uint8
+	for _, chunk := range chunks {
+		out = append(out, chunk...)
+	}
+	return out
+}
+
+
+// Rounds a ROM up to a whole number of banks by repeating it, small boards
+// leave address lines unconnected so the hardware sees the same mirroring
+func padRom(rom []uint8, bankSize int) []uint8 {
+	if len(rom) == 0 || len(rom) % bankSize == 0 {
+		return rom
+	}
+	size := (len(rom) / bankSize + 1) * bankSize
+	out := make([]uint8, size)
+	for i := 0; i < size; i += len(rom) {
+		copy(out[i:], rom)
+	}
+	return out
+}
@@ -0,0 +1,167 @@
+package emu
+
+
+// Konami VRC6 sound: two pulse channels and a sawtooth, all running off
+// the CPU clock with 12 bit period dividers
+type vrc6Pulse struct {
+	nVolume uint8
+	nDuty uint8
+	bConstant bool  // ignore the duty and output the volume continuously
+	nPeriod uint16
+	bEnable bool
+
+	nDivider uint16
+	nStep uint8  // counts down from 15, high while nStep <= nDuty
+}
+
+type vrc6Saw struct {
+	nRate uint8
+	nPeriod uint16
+	bEnable bool
+
+	nDivider uint16
+	nStep uint8  // 0-13, the accumulator is added to on every other step
+	nAccumulator uint8
+}
+
+type Vrc6Audio struct {
+	pulse [2]vrc6Pulse
+	saw vrc6Saw
+
+	bHalt bool
+	nPeriodShift uint8  // $9003 runs every channel 16 or 256 times faster
+}
+
+
+func NewVrc6Audio() *Vrc6Audio {
+	chip := Vrc6Audio{}
+	chip.Reset()
+	return &chip
+}
+
+
+// Writes one of the sound registers, reg is the $9000-$B002 register number
+// after the board's address line swap
+func (v *Vrc6Audio) Write(reg uint16, data uint8) {
+	if reg == 0x9003 {
+		v.bHalt = data & 0x01 != 0
+		switch {
+		case data & 0x04 != 0:
+			v.nPeriodShift = 8
+		case data & 0x02 != 0:
+			v.nPeriodShift = 4
+		default:
+			v.nPeriodShift = 0
+		}
+		return
+	}
+
+	if reg >= 0xB000 {
+		s := &v.saw
+		switch reg & 0x03 {
+		case 0:
+			s.nRate = data & 0x3F
+		case 1:
+			s.nPeriod = s.nPeriod & 0x0F00 | uint16(data)
+		case 2:
+			s.nPeriod = s.nPeriod & 0x00FF | uint16(data & 0x0F) << 8
+			s.bEnable = data & 0x80 != 0
+			if !s.bEnable {
+				s.nStep = 0
+				s.nAccumulator = 0
+			}
+		}
+		return
+	}
+
+	p := &v.pulse[(reg - 0x9000) >> 12]
+	switch reg & 0x03 {
+	case 0:
+		p.nVolume = data & 0x0F
+		p.nDuty = (data >> 4) & 0x07
+		p.bConstant = data & 0x80 != 0
+	case 1:
+		p.nPeriod = p.nPeriod & 0x0F00 | uint16(data)
+	case 2:
+		p.nPeriod = p.nPeriod & 0x00FF | uint16(data & 0x0F) << 8
+		p.bEnable = data & 0x80 != 0
+		if !p.bEnable {
+			p.nStep = 15
+		}
+	}
+}
+
+
+// Advances the chip by one CPU cycle
+func (v *Vrc6Audio) Clock() {
+	if v.bHalt {
+		return
+	}
+
+	for i := range v.pulse {
+		p := &v.pulse[i]
+		if !p.bEnable {
+			continue
+		}
+		if p.nDivider == 0 {
+			p.nDivider = p.nPeriod >> v.nPeriodShift
+			if p.nStep == 0 {
+				p.nStep = 15
+			} else {
+				p.nStep--
+			}
+		} else {
+			p.nDivider--
+		}
+	}
+
+	s := &v.saw
+	if !s.bEnable {
+		return
+	}
+	if s.nDivider == 0 {
+		s.nDivider = s.nPeriod >> v.nPeriodShift
+		s.nStep++
+		if s.nStep == 14 {
+			s.nStep = 0
+			s.nAccumulator = 0
+		} else if s.nStep & 0x01 == 0 {
+			s.nAccumulator += s.nRate
+		}
+	} else {
+		s.nDivider--
+	}
+}
+
+
+// Returns the mix of the three channels, from 0 to 1
+func (v *Vrc6Audio) Output() float32 {
+	out := 0
+	for _, p := range v.pulse {
+		if p.bEnable && (p.bConstant || p.nStep <= p.nDuty) {
+			out += int(p.nVolume)
+		}
+	}
+	out += int(v.saw.nAccumulator >> 3)
+
+	return float32(out) / 61  // 15 + 15 + 31
+}
+
+
+// The pulse channels at full volume are about as loud as the 2A03's
+func (v *Vrc6Audio) Level() float32 {
+	return 0.6
+}
+
+
+func (v *Vrc6Audio) Name() string {
+	return "vrc6"
+}
+
+
+func (v *Vrc6Audio) Reset() {
+	v.pulse = [2]vrc6Pulse{{nStep: 15}, {nStep: 15}}
+	v.saw = vrc6Saw{}
+	v.bHalt = false
+	v.nPeriodShift = 0
+}
@@ -0,0 +1,81 @@
+package emu
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+
+const wavHeaderSize = 44
+
+
+// Writes mono 16 bit PCM WAV files. The header's sizes are filled in by
+// Close, so the output has to be seekable
+type WavWriter struct {
+	w io.WriteSeeker
+	nSampleRate uint32
+	nSamples uint32
+	buffer []uint8
+}
+
+
+func NewWavWriter(w io.WriteSeeker, sampleRate int) (*WavWriter, error) {
+	wav := WavWriter{w: w, nSampleRate: uint32(sampleRate)}
+	if _, err := w.Write(wav.header()); err != nil {
+		return nil, err
+	}
+	return &wav, nil
+}
+
+
+func (wav *WavWriter) header() []uint8 {
+	dataSize := wav.nSamples * 2
+	h := make([]uint8, wavHeaderSize)
+
+	copy(h[0:], "RIFF")
+	binary.LittleEndian.PutUint32(h[4:], 36 + dataSize)
+	copy(h[8:], "WAVE")
+
+	copy(h[12:], "fmt ")
+	binary.LittleEndian.PutUint32(h[16:], 16)  // format chunk size
+	binary.LittleEndian.PutUint16(h[20:], 1)  // PCM
+	binary.LittleEndian.PutUint16(h[22:], 1)  // mono
+	binary.LittleEndian.PutUint32(h[24:], wav.nSampleRate)
+	binary.LittleEndian.PutUint32(h[28:], wav.nSampleRate * 2)  // byte rate
+	binary.LittleEndian.PutUint16(h[32:], 2)  // block align
+	binary.LittleEndian.PutUint16(h[34:], 16)  // bits per sample
+
+	copy(h[36:], "data")
+	binary.LittleEndian.PutUint32(h[40:], dataSize)
+	return h
+}
+
+
+func (wav *WavWriter) WriteSamples(samples []float32) error {
+	if cap(wav.buffer) < len(samples) * 2 {
+		wav.buffer = make([]uint8, len(samples) * 2)
+	}
+	buffer := wav.buffer[:len(samples) * 2]
+
+	for i, sample := range samples {
+		binary.LittleEndian.PutUint16(buffer[i * 2:], uint16(sampleToInt16(sample)))
+	}
+	if _, err := wav.w.Write(buffer); err != nil {
+		return err
+	}
+	wav.nSamples += uint32(len(samples))
+	return nil
+}
+
+
+// Fills in the header, the underlying writer is left open
+func (wav *WavWriter) Close() error {
+	if _, err := wav.w.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := wav.w.Write(wav.header()); err != nil {
+		return err
+	}
+	_, err := wav.w.Seek(0, io.SeekEnd)
+	return err
+}
@@ -4,11 +4,19 @@ import (
 	"LunaNES/emu"
 	"LunaNES/pixelengine"
 	"log"
+	"sync/atomic"
 	"time"
 
+	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/karalabe/usb"
 )
 
+const (
+	sampleRate = 48000
+	paceMode = emu.PACE_AUDIO  // or PACE_VSYNC / PACE_WALL_CLOCK
+	recordKey = ebiten.KeyF9  // toggles recording the audio, with a stem per channel
+)
+
 func main() {
 	bus := emu.NewBus()
 	cart := emu.NewCartridge("../ROMS/nestest.nes")
@@ -19,6 +27,19 @@ func main() {
 	bus.InsertCartridge(cart)
 	bus.Reset()
 
+	// Play the APU through the default audio device, SINK_NULL runs without one
+	bus.SetSampleRate(sampleRate)
+	if err := pixelengine.StartAudio(bus, sampleRate, pixelengine.SINK_EBITEN); err != nil {
+		log.Fatalf("Audio error: %v", err)
+	}
+	defer pixelengine.StopAudio()
+
+	// Persist battery backed saves periodically and on exit
+	cart.StartAutoSave(30 * time.Second, func(err error) {
+		log.Printf("Save error: %v", err)
+	})
+	defer cart.Close()
+
 	// Get device with NES controller's VID/PID
 	devices, err := usb.Enumerate(0x081f, 0xe401)
 	if err != nil {
@@ -82,29 +103,64 @@ func main() {
 		}
 	}()
 
-	// Start emulation loop
-	go func() {
-		ticker := time.NewTicker(time.Second / 60)
-		for range ticker.C {
-			// Run until the next frame is complete
-			for {
-				bus.Clock()
-				if bus.Ppu.FrameComplete {
-					bus.Ppu.FrameComplete = false
-					break
-				}
+	// The hotkey only flags a toggle, the recording is started and stopped
+	// between frames on the emulation goroutine
+	var toggleRecording int32
+	pixelengine.OnKeyPressed(recordKey, func() {
+		atomic.StoreInt32(&toggleRecording, 1)
+	})
+	toggle := func() {
+		if bus.Recording() {
+			if err := bus.StopRecording(); err != nil {
+				log.Printf("Recording error: %v", err)
 			}
+			log.Println("Recording stopped")
+			return
+		}
+		path := "recording-" + time.Now().Format("20060102-150405") + ".wav"
+		if err := bus.StartRecording(path, sampleRate, true); err != nil {
+			log.Printf("Recording error: %v", err)
+			return
+		}
+		log.Printf("Recording to %s", path)
+	}
 
-			// Render the screen from the PPU's framebuffer
-			screen := bus.Ppu.Screen()
-			for y := 0; y < 240; y++ {
-				for x := 0; x < 256; x++ {
-					p := screen[x][y]
-					pixelengine.SetPixel(x, y, p.R, p.G, p.B)
-				}
+	// Render the screen from the PPU's framebuffer
+	present := func() {
+		if atomic.SwapInt32(&toggleRecording, 0) == 1 {
+			toggle()
+		}
+
+		screen := bus.Ppu.Screen()
+		for y := 0; y < 240; y++ {
+			for x := 0; x < 256; x++ {
+				p := screen[x][y]
+				pixelengine.SetPixel(x, y, p.R, p.G, p.B)
 			}
 		}
-	}()
+	}
+
+	// Start emulation loop
+	pacer := emu.NewPacer(bus, paceMode)
+	if paceMode == emu.PACE_VSYNC {
+		pixelengine.SetVsyncFunc(func() {
+			pacer.Vsync(present)
+		})
+	} else {
+		// frames arrive on their own schedule, the pacer still needs to
+		// know about refreshes to count the ones that repeat a frame
+		pixelengine.SetDrawFunc(pacer.Refreshed)
+		pacer.Start(present)
+	}
 
 	pixelengine.Start()
+
+	// wait for the last frame before closing any recording
+	pacer.Stop()
+	if err := bus.StopRecording(); err != nil {
+		log.Printf("Recording error: %v", err)
+	}
+
+	stats := pacer.Stats()
+	log.Printf("Frames: %d, dropped: %d, duplicated: %d", stats.Frames, stats.Dropped, stats.Duplicated)
 }
@@ -44,11 +44,10 @@ func printCodeWindow(keys []uint16, mainKey uint16, dissasMap map[uint16]string)
 func main() {
 	cpu := emu.NewCPU()
 	bus := emu.NewBus()
-	cart := emu.NewCartridge("../ROMS/SuperMarioBros.nes")
-
-	if cart == nil {
-        log.Println("Error: cart is nil")
-    }
+	cart, err := emu.LoadCartridgeFile("../ROMS/SuperMarioBros.nes")
+	if err != nil {
+		log.Fatalln("Error: cartridge could not be loaded:", err)
+	}
 
 	bus.InsertCartridge(cart)
 
@@ -0,0 +1,227 @@
+package pixelengine
+
+import (
+    "encoding/binary"
+    "errors"
+    "sync"
+    "time"
+    "github.com/hajimehoshi/ebiten/v2/audio"
+)
+
+
+// Anything that can be pulled for mono samples at the host rate, e.g. emu.Bus
+type AudioSource interface {
+    ReadSamples(out []float32) int
+}
+
+// Where audio ends up
+const (
+    SINK_EBITEN = iota  // played through ebiten's audio context
+    SINK_NULL  // read at real time and discarded, for running without an audio device
+)
+
+const (
+    audioBufferTime = 50 * time.Millisecond  // ebiten player buffer, keeps latency down
+    nullSinkInterval = 10 * time.Millisecond
+    underrunDecay = 0.995  // how fast held samples fade out when the source runs dry
+)
+
+var ErrAudioStarted = errors.New("audio has already been started")
+
+
+// Converts the source's samples into what the sink wants, applying volume
+// and mute. If the source can't keep up the last sample is faded to
+// silence rather than cutting to zero, which would click
+type audioStream struct {
+    lock sync.Mutex
+    source AudioSource
+    volume float64
+    muted bool
+    samples []float32
+    last float32
+    underruns uint64
+}
+
+
+// Fills samples from the source, padding any shortfall, returns how many were real
+func (s *audioStream) fill(n int) int {
+    if cap(s.samples) < n {
+        s.samples = make([]float32, n)
+    }
+    s.samples = s.samples[:n]
+
+    got := s.source.ReadSamples(s.samples)
+    if got < n {
+        s.underruns++
+    }
+    if got > 0 {
+        s.last = s.samples[got - 1]
+    }
+    for i := got; i < n; i++ {
+        s.last *= underrunDecay
+        s.samples[i] = s.last
+    }
+
+    gain := float32(s.volume)
+    if s.muted {
+        gain = 0
+    }
+    for i := range s.samples {
+        s.samples[i] *= gain
+    }
+    return got
+}
+
+
+// Reads 16 bit little endian stereo frames for ebiten's player
+func (s *audioStream) Read(p []byte) (int, error) {
+    s.lock.Lock()
+    defer s.lock.Unlock()
+
+    frames := len(p) / 4
+    s.fill(frames)
+
+    for i, sample := range s.samples {
+        if sample > 1 {
+            sample = 1
+        } else if sample < -1 {
+            sample = -1
+        }
+        v := uint16(int16(sample * 32767))
+        binary.LittleEndian.PutUint16(p[i * 4:], v)
+        binary.LittleEndian.PutUint16(p[i * 4 + 2:], v)
+    }
+    return frames * 4, nil
+}
+
+
+var (
+    stream *audioStream
+    player *audio.Player
+    nullStop chan struct{}
+)
+
+
+// Starts playing audio pulled from source at sampleRate Hz through the
+// given sink. Only one source can be played, ebiten allows a single
+// audio context per process
+func StartAudio(source AudioSource, sampleRate int, sink int) error {
+    if stream != nil {
+        return ErrAudioStarted
+    }
+    stream = &audioStream{source: source, volume: 1}
+
+    switch sink {
+    case SINK_EBITEN:
+        context := audio.NewContext(sampleRate)
+        p, err := context.NewPlayer(stream)
+        if err != nil {
+            stream = nil
+            return err
+        }
+        p.SetBufferSize(audioBufferTime)
+        p.Play()
+        player = p
+
+    case SINK_NULL:
+        nullStop = make(chan struct{})
+        go runNullSink(stream, sampleRate, nullStop)
+    }
+
+    return nil
+}
+
+
+// Drains the stream at the rate a real device would
+func runNullSink(s *audioStream, sampleRate int, stop chan struct{}) {
+    ticker := time.NewTicker(nullSinkInterval)
+    defer ticker.Stop()
+
+    start := time.Now()
+    var consumed int64
+    for {
+        select {
+        case <-stop:
+            return
+        case now := <-ticker.C:
+            due := int64(now.Sub(start).Seconds() * float64(sampleRate)) - consumed
+            if due <= 0 {
+                continue
+            }
+            s.lock.Lock()
+            s.fill(int(due))
+            s.lock.Unlock()
+            consumed += due
+        }
+    }
+}
+
+
+// Stops audio, StartAudio can't be called again as ebiten keeps its context
+func StopAudio() {
+    if player != nil {
+        player.Close()
+        player = nil
+    }
+    if nullStop != nil {
+        close(nullStop)
+        nullStop = nil
+    }
+}
+
+
+// Sets the output volume, from 0 (silent) to 1 (full)
+func SetVolume(volume float64) {
+    if stream == nil {
+        return
+    }
+    if volume < 0 {
+        volume = 0
+    } else if volume > 1 {
+        volume = 1
+    }
+    stream.lock.Lock()
+    stream.volume = volume
+    stream.lock.Unlock()
+}
+
+
+func Volume() float64 {
+    if stream == nil {
+        return 0
+    }
+    stream.lock.Lock()
+    defer stream.lock.Unlock()
+    return stream.volume
+}
+
+
+func SetMuted(muted bool) {
+    if stream == nil {
+        return
+    }
+    stream.lock.Lock()
+    stream.muted = muted
+    stream.lock.Unlock()
+}
+
+
+func Muted() bool {
+    if stream == nil {
+        return false
+    }
+    stream.lock.Lock()
+    defer stream.lock.Unlock()
+    return stream.muted
+}
+
+
+// Returns how many times the sink asked for more audio than was ready
+func AudioUnderruns() uint64 {
+    if stream == nil {
+        return 0
+    }
+    stream.lock.Lock()
+    defer stream.lock.Unlock()
+    return stream.underruns
+}
@@ -5,6 +5,7 @@ import (
     "time"
     "LunaNES/emu"
     "github.com/hajimehoshi/ebiten/v2"
+    "github.com/hajimehoshi/ebiten/v2/inpututil"
 )
 
 
@@ -22,6 +23,10 @@ const (
 
 var pixels [ScreenWidth][ScreenHeight]Pixel
 
+var onVsync func()  // called on every display refresh when set
+var onDraw func()  // called every time the screen is drawn when set
+var keyHandlers = map[ebiten.Key]func(){}
+
 
 func init() {
 
@@ -35,11 +40,49 @@ type Window struct {
 
 
 func (g *Window) Update() error {
-    // Update logic can be added here if needed
+    for key, f := range keyHandlers {
+        if inpututil.IsKeyJustPressed(key) {
+            f()
+        }
+    }
+    if onVsync != nil {
+        onVsync()
+    }
     return nil
 }
 
 
+// Sets a function to be called when key is pressed, nil removes it.
+// Handlers run on the window's update loop
+func OnKeyPressed(key ebiten.Key, f func()) {
+    if f == nil {
+        delete(keyHandlers, key)
+    } else {
+        keyHandlers[key] = f
+    }
+}
+
+
+// Sets a function to be called once per display refresh instead of ebiten's
+// fixed 60 updates a second, for frontends that pace frames by vsync
+func SetVsyncFunc(f func()) {
+    onVsync = f
+    if f != nil {
+        ebiten.SetVsyncEnabled(true)
+        ebiten.SetTPS(ebiten.SyncWithFPS)
+    } else {
+        ebiten.SetTPS(ebiten.DefaultTPS)
+    }
+}
+
+
+// Sets a function to be called every time the window is drawn, which is
+// once per display refresh whether or not the pixels have changed
+func SetDrawFunc(f func()) {
+    onDraw = f
+}
+
+
 func Clear() {
     for x := 0; x < ScreenWidth; x++ {
         for y := 0; y < ScreenHeight; y++ {
@@ -50,6 +93,9 @@ func Clear() {
 
 
 func (g *Window) Draw(screen *ebiten.Image) {
+    if onDraw != nil {
+        onDraw()
+    }
     for x := 0; x < ScreenWidth; x++ {
         for y := 0; y < ScreenHeight; y++ {
             p := pixels[x][y]